@@ -4,17 +4,13 @@ import (
 	"context"
 	. "elevator/common"
 	"elevator/elevassigner"
-	"encoding/json"
 	"fmt"
-	"os/exec"
 	"time"
 )
 
 // constants (seconds)
 const (
 	NETWORK_PACKET_TIMEOUT = 2
-
-	HRA_EXECUTABLE = "hall_request_assigner"
 )
 
 func assignerThread(
@@ -22,6 +18,8 @@ func assignerThread(
 	config Config,
 	networkSnapshotCh <-chan Snapshot,
 	elevatorTasksCh chan<- ElevInput,
+	assignmentCh chan<- Assignment, // master/backup: leader's assignment to distribute
+	trafficCh chan<- string, // traffic mode detected here, to propose to the group
 ) {
 	// Use config.SelfKey (string "1","2",...)
 	selfKey := config.SelfKey
@@ -31,8 +29,24 @@ func assignerThread(
 		return
 	}
 
+	assignerConfig := elevassigner.AssignerConfig{
+		TravelDuration:   config.FloorTravelDuration,
+		DoorOpenDuration: config.DoorOpenDuration,
+		ClearRequestType: config.ClearRequestType,
+	}
+
+	// hall call history for detecting the traffic pattern. The detected mode is only a
+	// proposal: assignment uses the mode shared in the snapshot, so all nodes agree on it
+	history := elevassigner.NewCallHistory(config.TrafficDetectWindow)
+	detected := elevassigner.TM_InterFloor
+	mode := elevassigner.TM_InterFloor
+
+	// overdue hall requests already reported, by floor and button, with the time they were raised
+	escalated := make(map[[2]int]int64)
+	alarmed := make(map[[2]int]int64)
+
 	// state variables
-	currentElevInput := ElevInput{HallTask: make([][2]bool, 0)}
+	currentElevInput := ElevInput{HallTask: make([][2]bool, 0), ParkFloor: -1}
 
 	for {
 		select {
@@ -40,6 +54,38 @@ func assignerThread(
 			return
 
 		case networkSnapshot := <-networkSnapshotCh:
+			now := time.Now()
+			history.Observe(networkSnapshot.HallRequests, now)
+			if m := history.Mode(config.TrafficSchedule, config.LobbyFloor, now); m != detected {
+				select {
+				case trafficCh <- m.String():
+					detected = m
+				default:
+					// retried with the next snapshot
+				}
+			}
+			if m := elevassigner.TrafficModeFromString(networkSnapshot.Traffic.Mode); m != mode {
+				fmt.Printf("assignerThread: traffic mode %v -> %v\n", mode, m)
+				mode = m
+			}
+
+			// master/backup: followers apply the leader's assignment instead of running the assigner
+			leading := false
+			if config.CoordinationMode == "masterBackup" {
+				leader := elevassigner.Leader(networkSnapshot.Alive)
+				leading = leader == selfKey
+				if !leading {
+					a := networkSnapshot.Assignment
+					if a == nil || a.Leader != leader {
+						// nothing from the current leader yet, keep the tasks we have
+						break
+					}
+					currentElevInput = elevassigner.InputFor(*a, selfKey)
+					elevatorTasksCh <- currentElevInput
+					break
+				}
+			}
+
 			//delete elevators marked stale
 			err := elevassigner.RemoveStaleStates(&networkSnapshot, selfKey)
 			if err != nil {
@@ -47,31 +93,43 @@ func assignerThread(
 				break
 			}
 
-			// serialize snapshot to JSON
-			jsonBytes, err := json.Marshal(networkSnapshot)
-			if err != nil {
-				fmt.Println("json.Marshal error:", err)
+			// hall requests go to the elevators that can serve them; if that excludes
+			// this elevator, drop all of our hall tasks so they can be reassigned
+			// (a leader still assigns for the others)
+			elevassigner.RemoveUnavailableStates(&networkSnapshot)
+			_, selfAvailable := networkSnapshot.States[selfKey]
+			if !selfAvailable && !leading {
+				currentElevInput = ElevInput{HallTask: make([][2]bool, N_FLOORS), ParkFloor: -1}
+				elevatorTasksCh <- currentElevInput
 				break
-
 			}
 
-			// Run external hall request assigner executable
-			ret, err := exec.Command("./elevassigner/"+HRA_EXECUTABLE, "-i", string(jsonBytes)).CombinedOutput()
-			if err != nil {
-				fmt.Printf("exec.Command error: %v (states=%d, hall=%d)\n", err, len(networkSnapshot.States), len(networkSnapshot.HallRequests))
-				fmt.Println(string(ret))
-				break
-			}
+			// run the hall request assigner, using each elevator's own travel/door estimates
+			hallRequests := elevassigner.WithDestinations(networkSnapshot.HallRequests, networkSnapshot.DestinationRequests)
+			output, etas := elevassigner.AssignHallRequests(hallRequests, networkSnapshot.States, assignerConfig, mode)
 
-			// parse assigner output
-			var output map[string][][2]bool
-			if err := json.Unmarshal(ret, &output); err != nil {
-				fmt.Println("json.Unmarshal error:", err)
-				break
+			// hall requests waiting too long go to another car; far too long raises an alarm
+			overdue := elevassigner.EscalateOverdue(hallRequests, networkSnapshot.HallOverdue, networkSnapshot.HallSince,
+				networkSnapshot.States, assignerConfig, now, output, etas)
+			reportOverdue(overdue, networkSnapshot.HallSince, config.HallAlarmLimit, escalated, alarmed)
+
+			// idle elevators are spread over the home floors for the current traffic mode
+			homeFloors := elevassigner.HomeFloorsForMode(mode, config.HomeFloors, config.LobbyFloor, len(networkSnapshot.States))
+			parkFloors := elevassigner.ParkingFloors(networkSnapshot.States, output, homeFloors)
+
+			if leading {
+				select {
+				case assignmentCh <- elevassigner.NewAssignment(selfKey, output, etas, parkFloors):
+				default:
+				}
 			}
 
 			// pick tasks for THIS elevator to send to fsmthread
-			currentElevInput = ElevInput{HallTask: output[selfKey]}
+			if selfAvailable {
+				currentElevInput = ElevInput{HallTask: output[selfKey], HallETA: etas, ParkFloor: parkFloors[selfKey]}
+			} else {
+				currentElevInput = ElevInput{HallTask: make([][2]bool, N_FLOORS), ParkFloor: -1}
+			}
 			elevatorTasksCh <- currentElevInput
 
 		case <-time.After(NETWORK_PACKET_TIMEOUT * time.Second):
@@ -79,3 +137,31 @@ func assignerThread(
 		}
 	}
 }
+
+// reportOverdue logs each escalation once, and an alarm once per hall request that exceeds
+// alarmLimit. Entries for requests that are gone (or raised again) are forgotten.
+func reportOverdue(overdue []elevassigner.OverdueCall, since [][2]int64, alarmLimit time.Duration, escalated, alarmed map[[2]int]int64) {
+	current := make(map[[2]int]int64, len(overdue))
+	for _, call := range overdue {
+		key := [2]int{call.Floor, int(call.Button)}
+		raised := since[call.Floor][call.Button]
+		current[key] = raised
+
+		if escalated[key] != raised {
+			escalated[key] = raised
+			fmt.Printf("assignerThread: hall f=%d b=%s waiting %v, reassigned from %q to %q\n",
+				call.Floor, ElevioButtonToString(call.Button), call.Age.Round(time.Second), call.From, call.To)
+		}
+		if alarmLimit > 0 && call.Age >= alarmLimit && alarmed[key] != raised {
+			alarmed[key] = raised
+			fmt.Printf("assignerThread: ALARM hall f=%d b=%s not served for %v\n",
+				call.Floor, ElevioButtonToString(call.Button), call.Age.Round(time.Second))
+		}
+	}
+	for key, raised := range escalated {
+		if current[key] != raised {
+			delete(escalated, key)
+			delete(alarmed, key)
+		}
+	}
+}
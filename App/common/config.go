@@ -5,25 +5,128 @@ import (
 	"fmt"
 	"net"
 	"sort"
+	"time"
 )
 
 type Config struct {
 	// Optional: keep if you want known ports, but StartP2P will now accept any port directly.
 	Ports []int
 
+	// Port of the HTTP status API.
+	StatusPort int
+
 	// Hosts indexed by elevator id: 1..N (id 0 unused)
 	HostByID map[int]string
 
+	// How long the door stays open at a stop (and after an obstruction is removed).
+	DoorOpenDuration time.Duration
+
+	// Which requests a stop serves: "all" at the floor, or only those "inDirn" of travel.
+	// Same values as the hall request assigner's --clearRequestType.
+	ClearRequestType string
+
+	// Expected floor-to-floor travel time, used until a car has measured its own.
+	FloorTravelDuration time.Duration
+
+	// Longest time the car may travel between two floors before the motor is considered failed.
+	FloorTravelTimeout time.Duration
+
+	// How long the door may be held open by an obstruction before the car stops taking hall calls.
+	ObstructionFaultTimeout time.Duration
+
+	// Where cab requests are saved on shutdown and restored from on start.
+	CabRequestsFile string
+
+	// Longest time a graceful shutdown waits for the current door cycle to finish.
+	ShutdownTimeout time.Duration
+
+	// Floors idle cars are sent to, most important first (e.g. the lobby). Empty disables parking.
+	HomeFloors []int
+
+	// How long a car must have been idle before it goes to its home floor.
+	ParkingIdleDelay time.Duration
+
+	// The main entrance floor, where up-peak traffic starts.
+	LobbyFloor int
+
+	// Fixed dispatch modes by time of day. Outside these periods the mode is
+	// detected from the hall calls seen in the last TrafficDetectWindow.
+	TrafficSchedule     []TrafficPeriod
+	TrafficDetectWindow time.Duration
+
+	// How hall requests are assigned: "peerToPeer", where every node runs the assigner on
+	// its own world view, or "masterBackup", where the alive node with the lowest id (the
+	// leader) assigns for everyone and the next one takes over if it fails.
+	CoordinationMode string
+
+	// Hall input mode: "conventional" (up/down buttons only) or "destination", where
+	// callers also enter their destination floor (POST /destination on the status API).
+	DispatchMode string
+
+	// Car load (percent of capacity) from which a car skips hall calls, 0 to disable.
+	FullLoadPercent int
+
+	// Where the car load comes from: "api" (POST /load on the status API, standing in
+	// for a load sensor) or "simulated" (passengers board at hall stops, leave at cab stops).
+	LoadSource string
+
+	// A hall request older than HallServiceDeadline is taken from the car it would normally
+	// go to and given to another; one older than HallAlarmLimit raises an alarm.
+	HallServiceDeadline time.Duration
+	HallAlarmLimit      time.Duration
+
+	// Two presses on a lit cab button within this window cancel the cab request, 0 to disable.
+	CabCancelWindow time.Duration
+
+	// Floor all cars go to, and open their doors at, in fire-service recall.
+	RecallFloor int
+
+	// Floor a car in maintenance parks at with the door open, -1 to stay where it is.
+	MaintenanceFloor int
+
+	// How long the stop button must be held to toggle maintenance mode.
+	MaintenanceHoldTime time.Duration
+
 	// Filled by InitSelf() or by DefaultConfig()/MustDefaultConfig().
 	SelfID  int
 	SelfKey string
 }
 
+// TrafficPeriod fixes the dispatch mode ("upPeak", "downPeak" or "interFloor") from From
+// to To, both local time of day as "15:04". A period may wrap past midnight.
+type TrafficPeriod struct {
+	From string
+	To   string
+	Mode string
+}
+
 // DefaultConfig builds the config AND detects self.
 // Safe version: returns err if self cannot be detected.
 func DefaultConfig() (Config, string, error) {
 	cfg := Config{
-		Ports: []int{4242, 4243},
+		Ports:                   []int{4242, 4243},
+		StatusPort:              8080,
+		DoorOpenDuration:        3 * time.Second,
+		ClearRequestType:        "inDirn",
+		FloorTravelDuration:     2500 * time.Millisecond,
+		FloorTravelTimeout:      5 * time.Second,
+		ObstructionFaultTimeout: 8 * time.Second,
+		CabRequestsFile:         "cab_requests.json",
+		ShutdownTimeout:         15 * time.Second,
+		HomeFloors:              []int{0, N_FLOORS / 2},
+		ParkingIdleDelay:        10 * time.Second,
+		LobbyFloor:              0,
+		TrafficDetectWindow:     5 * time.Minute,
+		CoordinationMode:        "peerToPeer",
+		DispatchMode:            "conventional",
+		FullLoadPercent:         80,
+		LoadSource:              "api",
+		HallServiceDeadline:     45 * time.Second,
+		HallAlarmLimit:          2 * time.Minute,
+		CabCancelWindow:         600 * time.Millisecond,
+		RecallFloor:             0,
+		MaintenanceFloor:        0,
+		MaintenanceHoldTime:     5 * time.Second,
 		HostByID: map[int]string{
 			1: "10.100.23.34",
 			2: "10.100.23.35",
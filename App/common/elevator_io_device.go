@@ -86,6 +86,13 @@ func ElevioGetOutputDevice() ElevOutputDevice {
 	}
 }
 
+func (d ElevOutputDevice) StopButtonLight(v bool) {
+	if d.stopButtonLight == nil {
+		return
+	}
+	d.stopButtonLight(v)
+}
+
 func ElevioDirnToString(d MotorDirection) string { //TODO: Remove after no need for printing 
 	switch d {
 	case MD_Up:
@@ -1,5 +1,7 @@
 package common
 
+import "time"
+
 type UpdateKind int
 
 const (
@@ -8,21 +10,80 @@ const (
 )
 
 type ElevState struct {
+	// Set by the elevator's own node and increased with every update it makes, so copies
+	// relayed or delayed through other nodes never replace a newer one.
+	Version uint64 `json:"version"`
+
 	Behavior    string `json:"behaviour"`
 	Floor       int    `json:"floor"`
 	Direction   string `json:"direction"`
 	CabRequests []bool `json:"cabRequests"`
+	// Cab requests cancelled by the passenger that the group may still hold as active.
+	CabCancelled []bool `json:"cabCancelled,omitempty"`
+
+	MotorFailure     bool `json:"motorFailure"`
+	ObstructionFault bool `json:"obstructionFault"`
+	Maintenance      bool `json:"maintenance"`
+	Load             int  `json:"load,omitempty"` // percent of capacity
+	Full             bool `json:"full"`
+
+	// Measured floor-to-floor travel time and door cycle time (0 = no estimate yet).
+	TravelDurationMs   int `json:"travelDuration,omitempty"`
+	DoorOpenDurationMs int `json:"doorOpenDuration,omitempty"`
+
+	// Predicted arrival (unix ms) for the hall requests assigned to this elevator, 0 if not assigned.
+	HallETAs [][2]int64 `json:"hallEtas,omitempty"`
 }
 
 type Snapshot struct {
-	HallRequests [][2]bool            `json:"hallRequests"`
-	States       map[string]ElevState `json:"states"`
-	Alive        map[string]bool      `json:"alive"`
-	UpdateKind   UpdateKind           `json:"type"`
+	HallRequests [][2]bool `json:"hallRequests"`
+	// When each active hall request was first seen (unix ms), 0 when inactive.
+	HallSince [][2]int64 `json:"hallSince,omitempty"`
+	// Active hall requests past the service deadline. The first node whose clock says so
+	// sets the flag, and every node escalates from the flag, so they all escalate alike.
+	HallOverdue [][2]bool `json:"hallOverdue,omitempty"`
+	// Destination dispatch calls, [from][to]. Each one also raises the hall request at
+	// "from" in its direction; the car that serves that hall request picks it up.
+	DestinationRequests [][]bool             `json:"destinationRequests,omitempty"`
+	States              map[string]ElevState `json:"states"`
+	Alive               map[string]bool      `json:"alive"`
+	Recall              RecallState          `json:"recall"`
+	Traffic             TrafficState         `json:"traffic"`
+	Assignment          *Assignment          `json:"assignment,omitempty"`
+	UpdateKind          UpdateKind           `json:"type"`
+}
+
+// RecallState is the group-wide fire-service recall mode. Every change bumps Epoch and the
+// higher epoch wins when snapshots are merged, so nodes that join later or were cut off
+// during the change still pick it up.
+type RecallState struct {
+	Active bool   `json:"active"`
+	Epoch  uint64 `json:"epoch"`
+}
+
+// TrafficState is the group-wide traffic mode the hall requests are assigned with. Each
+// node proposes a mode when its own detection changes; like recall, the higher epoch wins,
+// so every node assigns with the same mode. By (the proposing node) breaks ties.
+type TrafficState struct {
+	Mode  string `json:"mode"` // "interFloor", "upPeak" or "downPeak"; empty is interFloor
+	Epoch uint64 `json:"epoch"`
+	By    string `json:"by"`
+}
+
+// Assignment is the hall assignment the leader computes for the whole group in
+// master/backup coordination. Seq grows with every change, across leaders.
+type Assignment struct {
+	Leader     string               `json:"leader"`
+	Seq        uint64               `json:"seq"`
+	HallTasks  map[string][][2]bool `json:"hallTasks"`
+	HallETAsMs [][2]int64           `json:"hallEtas"` // time until arrival when issued
+	ParkFloors map[string]int       `json:"parkFloors"`
 }
 
 type ElevInput struct {
-	HallTask [][2]bool `json:"HallTask"`
+	HallTask  [][2]bool          `json:"HallTask"`
+	HallETA   [][2]time.Duration `json:"HallETA"`   // time until arrival, per hall request
+	ParkFloor int                `json:"ParkFloor"` // home floor to park at when idle, -1 for none
 }
 
 type HRAOutput struct {
@@ -1,5 +1,7 @@
 package common
 
+import "strconv"
+
 func TrimZeros(b []byte) []byte {
 	i := len(b)
 	for i > 0 && b[i-1] == 0 {
@@ -14,6 +16,14 @@ func CopyElevState(st ElevState) ElevState {
 		cp.CabRequests = make([]bool, len(st.CabRequests))
 		copy(cp.CabRequests, st.CabRequests)
 	}
+	if st.CabCancelled != nil {
+		cp.CabCancelled = make([]bool, len(st.CabCancelled))
+		copy(cp.CabCancelled, st.CabCancelled)
+	}
+	if st.HallETAs != nil {
+		cp.HallETAs = make([][2]int64, len(st.HallETAs))
+		copy(cp.HallETAs, st.HallETAs)
+	}
 	return cp
 }
 
@@ -26,8 +36,78 @@ func DeepCopySnapshot(ns Snapshot) Snapshot {
 		snapshotCopy.HallRequests = make([][2]bool, len(ns.HallRequests))
 		copy(snapshotCopy.HallRequests, ns.HallRequests)
 	}
+	if ns.HallSince != nil {
+		snapshotCopy.HallSince = make([][2]int64, len(ns.HallSince))
+		copy(snapshotCopy.HallSince, ns.HallSince)
+	}
+	if ns.HallOverdue != nil {
+		snapshotCopy.HallOverdue = make([][2]bool, len(ns.HallOverdue))
+		copy(snapshotCopy.HallOverdue, ns.HallOverdue)
+	}
+	snapshotCopy.DestinationRequests = CopyDestinations(ns.DestinationRequests)
+	snapshotCopy.Recall = ns.Recall
+	snapshotCopy.Traffic = ns.Traffic
+	if ns.Assignment != nil {
+		a := CopyAssignment(*ns.Assignment)
+		snapshotCopy.Assignment = &a
+	}
 	for k, st := range ns.States {
 		snapshotCopy.States[k] = CopyElevState(st)
 	}
 	return snapshotCopy
 }
+
+// CopyDestinations deep-copies a destination request matrix; nil stays nil.
+func CopyDestinations(dest [][]bool) [][]bool {
+	if dest == nil {
+		return nil
+	}
+	cp := make([][]bool, len(dest))
+	for i := range dest {
+		cp[i] = make([]bool, len(dest[i]))
+		copy(cp[i], dest[i])
+	}
+	return cp
+}
+
+// NewDestinations returns an empty N_FLOORS x N_FLOORS destination request matrix.
+func NewDestinations() [][]bool {
+	dest := make([][]bool, N_FLOORS)
+	for i := range dest {
+		dest[i] = make([]bool, N_FLOORS)
+	}
+	return dest
+}
+
+// DestinationButton is the hall button a destination call from "from" to "to" raises.
+func DestinationButton(from int, to int) ButtonType {
+	if to > from {
+		return BT_HallUp
+	}
+	return BT_HallDown
+}
+
+// KeyLess orders node keys by their numeric elevator id, and lexically if not numeric.
+func KeyLess(a, b string) bool {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil {
+		return na < nb
+	}
+	return a < b
+}
+
+// CopyAssignment deep-copies a leader assignment.
+func CopyAssignment(a Assignment) Assignment {
+	cp := a
+	cp.HallTasks = make(map[string][][2]bool, len(a.HallTasks))
+	for id, hall := range a.HallTasks {
+		cp.HallTasks[id] = append([][2]bool(nil), hall...)
+	}
+	cp.HallETAsMs = append([][2]int64(nil), a.HallETAsMs...)
+	cp.ParkFloors = make(map[string]int, len(a.ParkFloors))
+	for id, f := range a.ParkFloors {
+		cp.ParkFloors[id] = f
+	}
+	return cp
+}
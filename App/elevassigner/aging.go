@@ -0,0 +1,90 @@
+package elevassigner
+
+import (
+	. "elevator/common"
+	"sort"
+	"time"
+)
+
+// A hall request can wait forever if the car it goes to is broken in a way that does not
+// show in its state. Once a request is marked overdue in the snapshot (see
+// Snapshot.HallOverdue, set when it passes the service deadline) it is escalated:
+// it goes to the best car other than the one the normal assignment picks. Excluding the
+// normal pick, rather than the current holder, keeps the choice stable from one snapshot
+// to the next and the same on every node.
+
+// OverdueCall is a hall request older than the service deadline.
+type OverdueCall struct {
+	Floor  int
+	Button ButtonType
+	Age    time.Duration
+	From   string // the car the normal assignment gave it to
+	To     string // the car it was escalated to, "" if there is none
+}
+
+// HallAge returns how long the hall request has been active, 0 if unknown.
+func HallAge(since [][2]int64, floor int, button int, now time.Time) time.Duration {
+	if floor >= len(since) || since[floor][button] == 0 {
+		return 0
+	}
+	return now.Sub(time.UnixMilli(since[floor][button]))
+}
+
+// EscalateOverdue reassigns, in output and etas, every hall request marked overdue. Which
+// requests are escalated, and to which car, depends only on the shared snapshot; now only
+// sets the reported age.
+func EscalateOverdue(
+	hallRequests [][2]bool,
+	overdueFlags [][2]bool,
+	since [][2]int64,
+	states map[string]ElevState,
+	config AssignerConfig,
+	now time.Time,
+	output map[string][][2]bool,
+	etas [][2]time.Duration,
+) []OverdueCall {
+	ids := make([]string, 0, len(output))
+	for id := range output {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var overdue []OverdueCall
+	for f := 0; f < N_FLOORS && f < len(hallRequests); f++ {
+		for c := range 2 {
+			if !hallRequests[f][c] || f >= len(overdueFlags) || !overdueFlags[f][c] {
+				continue
+			}
+			call := OverdueCall{Floor: f, Button: ButtonType(c), Age: HallAge(since, f, c, now)}
+			for _, id := range ids {
+				if output[id][f][c] {
+					call.From = id
+				}
+			}
+
+			others := make(map[string]ElevState, len(states))
+			for id, st := range states {
+				if id != call.From {
+					others[id] = st
+				}
+			}
+			single := make([][2]bool, N_FLOORS)
+			single[f][c] = true
+			alt, altETAs := OptimalHallRequests(single, others, config)
+			for id, hall := range alt {
+				if hall[f][c] {
+					call.To = id
+				}
+			}
+			if call.To != "" {
+				if call.From != "" {
+					output[call.From][f][c] = false
+				}
+				output[call.To][f][c] = true
+				etas[f][c] = altETAs[f][c]
+			}
+			overdue = append(overdue, call)
+		}
+	}
+	return overdue
+}
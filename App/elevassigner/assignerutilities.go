@@ -5,8 +5,6 @@ import (
 	"errors"
 )
 
-const HRA_EXECUTABLE = "hall_request_assigner" // Linux only
-
 // RemoveStaleStates removes the elevator states for the nodes that are marked as stale.
 // It mutates networkSnapshot by deleting entries from networkSnapshot.States.
 func RemoveStaleStates(networkSnapshot *Snapshot, selfKey string) error {
@@ -23,3 +21,27 @@ func RemoveStaleStates(networkSnapshot *Snapshot, selfKey string) error {
 	}
 	return removeStaleStatesErr
 }
+
+// RemoveUnavailableStates removes the elevator states that cannot take hall requests,
+// i.e. states whose behaviour is not one the hall request assigner understands
+// (for example an elevator in emergency stop) or that have a motor or obstruction fault.
+// Cab requests of those elevators are unaffected; they are served locally.
+func RemoveUnavailableStates(networkSnapshot *Snapshot) {
+	for id, state := range networkSnapshot.States {
+		if !hallAvailable(state) {
+			delete(networkSnapshot.States, id)
+		}
+	}
+}
+
+func hallAvailable(state ElevState) bool {
+	if state.MotorFailure || state.ObstructionFault || state.Maintenance || state.Full {
+		return false
+	}
+	switch state.Behavior {
+	case "idle", "moving", "doorOpen":
+		return true
+	default:
+		return false
+	}
+}
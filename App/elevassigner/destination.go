@@ -0,0 +1,21 @@
+package elevassigner
+
+import (
+	. "elevator/common"
+)
+
+// WithDestinations returns the hall requests to assign: the hall requests plus the hall
+// request each destination call stands for (at its origin, in its direction of travel).
+// The elevator that gets that hall request picks up the destination calls waiting there.
+func WithDestinations(hallRequests [][2]bool, destinations [][]bool) [][2]bool {
+	hall := make([][2]bool, N_FLOORS)
+	copy(hall, hallRequests)
+	for from := 0; from < N_FLOORS && from < len(destinations); from++ {
+		for to := 0; to < N_FLOORS && to < len(destinations[from]); to++ {
+			if destinations[from][to] && from != to {
+				hall[from][DestinationButton(from, to)] = true
+			}
+		}
+	}
+	return hall
+}
@@ -0,0 +1,383 @@
+package elevassigner
+
+import (
+	. "elevator/common"
+	"sort"
+	"time"
+)
+
+// Go port of the hall_request_assigner executable (TTK4145 Project-resources).
+// Every elevator is simulated forward in time, always advancing the one that is
+// furthest behind, and each hall request goes to the elevator that reaches it first.
+// Unlike the executable, travel and door durations are per elevator, taken from the
+// estimates each elevator reports in its ElevState.
+
+// AssignerConfig holds the durations used for elevators that report no estimates,
+// and the request clearing policy ("all" or "inDirn").
+type AssignerConfig struct {
+	TravelDuration   time.Duration
+	DoorOpenDuration time.Duration
+	ClearRequestType string
+}
+
+type hallReq struct {
+	active     bool
+	assignedTo string
+	arrival    time.Duration
+}
+
+type simElevator struct {
+	id          string
+	floor       int
+	behaviour   string
+	direction   int
+	cabRequests []bool
+	time        time.Duration
+
+	travelDuration   time.Duration
+	doorOpenDuration time.Duration
+}
+
+const (
+	dirnDown = -1
+	dirnStop = 0
+	dirnUp   = 1
+)
+
+// OptimalHallRequests assigns every active hall request to exactly one of the given
+// elevators. Elevators with an invalid floor get nothing. Alongside the assignment it
+// returns the predicted time until the assigned elevator arrives for each hall request
+// (0 for inactive or unassigned requests), from the same simulation.
+func OptimalHallRequests(hallRequests [][2]bool, states map[string]ElevState, config AssignerConfig) (map[string][][2]bool, [][2]time.Duration) {
+	reqs := make([][2]hallReq, N_FLOORS)
+	for f := 0; f < N_FLOORS && f < len(hallRequests); f++ {
+		for c := 0; c < 2; c++ {
+			reqs[f][c].active = hallRequests[f][c]
+		}
+	}
+
+	elevators := initialElevators(states, config)
+
+	result := make(map[string][][2]bool, len(states))
+	for id := range states {
+		result[id] = make([][2]bool, N_FLOORS)
+	}
+	etas := make([][2]time.Duration, N_FLOORS)
+	if len(elevators) == 0 {
+		return result, etas
+	}
+
+	for i := range elevators {
+		performInitialMove(&elevators[i], reqs)
+	}
+
+	for {
+		sort.SliceStable(elevators, func(a, b int) bool {
+			return elevators[a].time < elevators[b].time
+		})
+
+		done := !anyUnassigned(reqs)
+		if unvisitedAreImmediatelyAssignable(reqs, elevators) {
+			assignImmediate(reqs, elevators)
+			done = true
+		}
+		if done {
+			break
+		}
+
+		performSingleMove(&elevators[0], reqs, config.ClearRequestType)
+	}
+
+	for f := range reqs {
+		for c := range reqs[f] {
+			if reqs[f][c].active && reqs[f][c].assignedTo != "" {
+				result[reqs[f][c].assignedTo][f][c] = true
+				etas[f][c] = reqs[f][c].arrival
+			}
+		}
+	}
+	return result, etas
+}
+
+// initialElevators builds the simulation state in id order. The start times are offset
+// by a microsecond per elevator so ties are broken the same way on every node.
+func initialElevators(states map[string]ElevState, config AssignerConfig) []simElevator {
+	ids := make([]string, 0, len(states))
+	for id, st := range states {
+		if st.Floor >= 0 && st.Floor < N_FLOORS {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	elevators := make([]simElevator, 0, len(ids))
+	for i, id := range ids {
+		st := states[id]
+		el := simElevator{
+			id:               id,
+			floor:            st.Floor,
+			behaviour:        st.Behavior,
+			direction:        dirnFromString(st.Direction),
+			cabRequests:      make([]bool, N_FLOORS),
+			time:             time.Duration(i) * time.Microsecond,
+			travelDuration:   config.TravelDuration,
+			doorOpenDuration: config.DoorOpenDuration,
+		}
+		copy(el.cabRequests, st.CabRequests)
+		if st.TravelDurationMs > 0 {
+			el.travelDuration = time.Duration(st.TravelDurationMs) * time.Millisecond
+		}
+		if st.DoorOpenDurationMs > 0 {
+			el.doorOpenDuration = time.Duration(st.DoorOpenDurationMs) * time.Millisecond
+		}
+		elevators = append(elevators, el)
+	}
+	return elevators
+}
+
+func dirnFromString(s string) int {
+	switch s {
+	case "up":
+		return dirnUp
+	case "down":
+		return dirnDown
+	default:
+		return dirnStop
+	}
+}
+
+func anyUnassigned(reqs [][2]hallReq) bool {
+	for f := range reqs {
+		for c := range reqs[f] {
+			if reqs[f][c].active && reqs[f][c].assignedTo == "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func anyCab(el simElevator) bool {
+	for _, cab := range el.cabRequests {
+		if cab {
+			return true
+		}
+	}
+	return false
+}
+
+// unvisitedAreImmediatelyAssignable is true when every unassigned request is at a floor
+// where an elevator without cab requests is already standing.
+func unvisitedAreImmediatelyAssignable(reqs [][2]hallReq, elevators []simElevator) bool {
+	for _, el := range elevators {
+		if anyCab(el) {
+			return false
+		}
+	}
+	for f := range reqs {
+		if reqs[f][0].active && reqs[f][1].active {
+			return false
+		}
+		for c := range reqs[f] {
+			if !reqs[f][c].active || reqs[f][c].assignedTo != "" {
+				continue
+			}
+			found := false
+			for _, el := range elevators {
+				if el.floor == f && !anyCab(el) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func assignImmediate(reqs [][2]hallReq, elevators []simElevator) {
+	for f := range reqs {
+		for c := range reqs[f] {
+			for i := range elevators {
+				el := &elevators[i]
+				if reqs[f][c].active && reqs[f][c].assignedTo == "" && el.floor == f && !anyCab(*el) {
+					reqs[f][c].assignedTo = el.id
+					reqs[f][c].arrival = el.time
+					el.time += el.doorOpenDuration
+				}
+			}
+		}
+	}
+}
+
+func performInitialMove(el *simElevator, reqs [][2]hallReq) {
+	switch el.behaviour {
+	case "doorOpen":
+		el.time += el.doorOpenDuration / 2
+		fallthrough
+	case "idle":
+		for c := 0; c < 2; c++ {
+			if reqs[el.floor][c].active {
+				reqs[el.floor][c].assignedTo = el.id
+				reqs[el.floor][c].arrival = el.time
+				el.time += el.doorOpenDuration
+			}
+		}
+	case "moving":
+		if next := el.floor + el.direction; next >= 0 && next < N_FLOORS {
+			el.floor = next
+			el.time += el.travelDuration / 2
+		}
+	}
+}
+
+// simRequests is the request table the simulated elevator acts on: its own cab
+// requests plus every hall request nobody has claimed yet.
+func simRequests(el *simElevator, reqs [][2]hallReq) [][3]bool {
+	table := make([][3]bool, N_FLOORS)
+	for f := range table {
+		table[f][0] = reqs[f][0].active && reqs[f][0].assignedTo == ""
+		table[f][1] = reqs[f][1].active && reqs[f][1].assignedTo == ""
+		table[f][2] = el.cabRequests[f]
+	}
+	return table
+}
+
+func performSingleMove(el *simElevator, reqs [][2]hallReq, clearRequestType string) {
+	table := simRequests(el, reqs)
+
+	// the doors open at el.time, before the door duration is added
+	arrival := el.time
+	onClearedRequest := func(c int) {
+		if c == 2 {
+			el.cabRequests[el.floor] = false
+		} else {
+			reqs[el.floor][c].assignedTo = el.id
+			reqs[el.floor][c].arrival = arrival
+		}
+	}
+
+	switch el.behaviour {
+	case "moving":
+		if simShouldStop(table, el.floor, el.direction) {
+			el.behaviour = "doorOpen"
+			el.time += el.doorOpenDuration
+			simClearAtCurrentFloor(table, el.floor, el.direction, clearRequestType, onClearedRequest)
+		} else {
+			el.floor += el.direction
+			el.time += el.travelDuration
+		}
+	default: // idle, doorOpen
+		el.direction = simChooseDirection(table, el.floor, el.direction)
+		if el.direction == dirnStop {
+			if simAnyHere(table, el.floor) {
+				simClearAtCurrentFloor(table, el.floor, el.direction, clearRequestType, onClearedRequest)
+				el.time += el.doorOpenDuration
+				el.behaviour = "doorOpen"
+			} else {
+				el.behaviour = "idle"
+			}
+		} else {
+			el.behaviour = "moving"
+			el.floor += el.direction
+			el.time += el.travelDuration
+		}
+	}
+}
+
+func simAbove(table [][3]bool, floor int) bool {
+	for f := floor + 1; f < len(table); f++ {
+		if table[f][0] || table[f][1] || table[f][2] {
+			return true
+		}
+	}
+	return false
+}
+
+func simBelow(table [][3]bool, floor int) bool {
+	for f := 0; f < floor; f++ {
+		if table[f][0] || table[f][1] || table[f][2] {
+			return true
+		}
+	}
+	return false
+}
+
+func simAnyHere(table [][3]bool, floor int) bool {
+	return table[floor][0] || table[floor][1] || table[floor][2]
+}
+
+func simChooseDirection(table [][3]bool, floor int, direction int) int {
+	switch direction {
+	case dirnUp:
+		switch {
+		case simAbove(table, floor):
+			return dirnUp
+		case simAnyHere(table, floor):
+			return dirnStop
+		case simBelow(table, floor):
+			return dirnDown
+		}
+	default:
+		switch {
+		case simBelow(table, floor):
+			return dirnDown
+		case simAnyHere(table, floor):
+			return dirnStop
+		case simAbove(table, floor):
+			return dirnUp
+		}
+	}
+	return dirnStop
+}
+
+func simShouldStop(table [][3]bool, floor int, direction int) bool {
+	switch direction {
+	case dirnDown:
+		return table[floor][1] || table[floor][2] || !simBelow(table, floor)
+	case dirnUp:
+		return table[floor][0] || table[floor][2] || !simAbove(table, floor)
+	default:
+		return true
+	}
+}
+
+func simClearAtCurrentFloor(table [][3]bool, floor int, direction int, clearRequestType string, onCleared func(int)) {
+	clear := func(c int) {
+		if table[floor][c] {
+			table[floor][c] = false
+			onCleared(c)
+		}
+	}
+
+	if clearRequestType == "all" {
+		clear(0)
+		clear(1)
+		clear(2)
+		return
+	}
+
+	clear(2)
+	switch direction {
+	case dirnUp:
+		if table[floor][0] {
+			clear(0)
+		} else if !simAbove(table, floor) {
+			clear(1)
+		}
+	case dirnDown:
+		if table[floor][1] {
+			clear(1)
+		} else if !simBelow(table, floor) {
+			clear(0)
+		}
+	default:
+		if table[floor][0] {
+			clear(0)
+		} else {
+			clear(1)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package elevassigner
+
+import (
+	. "elevator/common"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Input/output pairs recorded from the hall_request_assigner executable with its default
+// durations (--travelDuration 2500 --doorOpenDuration 3000). The Go port must give the same
+// assignment, ties included.
+var goldenAssignments = []struct {
+	name             string
+	clearRequestType string
+	input            string
+	output           string
+}{
+	{
+		"readme", "inDirn",
+		`{"hallRequests":[[false,false],[true,false],[false,false],[false,true]],"states":{"one":{"behaviour":"moving","floor":2,"direction":"up","cabRequests":[false,false,true,true]},"two":{"behaviour":"idle","floor":0,"direction":"stop","cabRequests":[false,false,false,false]}}}`,
+		`{"one":[[false,false],[false,false],[false,false],[false,true]],"two":[[false,false],[true,false],[false,false],[false,false]]}`,
+	},
+	{
+		"tie same floor", "inDirn",
+		`{"hallRequests":[[false,false],[false,false],[true,false],[false,false]],"states":{"a":{"behaviour":"idle","floor":0,"direction":"stop","cabRequests":[false,false,false,false]},"b":{"behaviour":"idle","floor":0,"direction":"stop","cabRequests":[false,false,false,false]}}}`,
+		`{"a":[[false,false],[false,false],[true,false],[false,false]],"b":[[false,false],[false,false],[false,false],[false,false]]}`,
+	},
+	{
+		"tie both sides", "inDirn",
+		`{"hallRequests":[[false,false],[false,true],[false,false],[false,false]],"states":{"a":{"behaviour":"idle","floor":0,"direction":"stop","cabRequests":[false,false,false,false]},"b":{"behaviour":"idle","floor":2,"direction":"stop","cabRequests":[false,false,false,false]}}}`,
+		`{"a":[[false,false],[false,true],[false,false],[false,false]],"b":[[false,false],[false,false],[false,false],[false,false]]}`,
+	},
+	{
+		"tie three idle", "inDirn",
+		`{"hallRequests":[[true,false],[false,false],[false,false],[false,true]],"states":{"1":{"behaviour":"idle","floor":1,"direction":"stop","cabRequests":[false,false,false,false]},"2":{"behaviour":"idle","floor":1,"direction":"stop","cabRequests":[false,false,false,false]},"3":{"behaviour":"idle","floor":1,"direction":"stop","cabRequests":[false,false,false,false]}}}`,
+		`{"1":[[true,false],[false,false],[false,false],[false,true]],"2":[[false,false],[false,false],[false,false],[false,false]],"3":[[false,false],[false,false],[false,false],[false,false]]}`,
+	},
+	{
+		"single elevator", "inDirn",
+		`{"hallRequests":[[true,false],[false,true],[true,true],[false,true]],"states":{"only":{"behaviour":"moving","floor":1,"direction":"up","cabRequests":[false,false,true,false]}}}`,
+		`{"only":[[true,false],[false,true],[true,true],[false,true]]}`,
+	},
+	{
+		"single elevator all", "all",
+		`{"hallRequests":[[true,false],[false,true],[true,true],[false,true]],"states":{"only":{"behaviour":"moving","floor":1,"direction":"up","cabRequests":[false,false,true,false]}}}`,
+		`{"only":[[true,false],[false,true],[true,true],[false,true]]}`,
+	},
+	{
+		"all busy", "inDirn",
+		`{"hallRequests":[[true,false],[true,true],[false,true],[false,true]],"states":{"a":{"behaviour":"moving","floor":1,"direction":"up","cabRequests":[false,false,false,true]},"b":{"behaviour":"doorOpen","floor":2,"direction":"down","cabRequests":[true,false,false,false]},"c":{"behaviour":"moving","floor":3,"direction":"down","cabRequests":[false,true,false,false]}}}`,
+		`{"a":[[false,false],[true,false],[false,false],[false,true]],"b":[[false,false],[false,false],[false,true],[false,false]],"c":[[true,false],[false,true],[false,false],[false,false]]}`,
+	},
+	{
+		"all busy all", "all",
+		`{"hallRequests":[[true,false],[true,true],[false,true],[false,true]],"states":{"a":{"behaviour":"moving","floor":1,"direction":"up","cabRequests":[false,false,false,true]},"b":{"behaviour":"doorOpen","floor":2,"direction":"down","cabRequests":[true,false,false,false]},"c":{"behaviour":"moving","floor":3,"direction":"down","cabRequests":[false,true,false,false]}}}`,
+		`{"a":[[false,false],[false,false],[false,false],[false,true]],"b":[[false,false],[false,false],[false,true],[false,false]],"c":[[true,false],[true,true],[false,false],[false,false]]}`,
+	},
+	{
+		"door open at request", "inDirn",
+		`{"hallRequests":[[false,false],[true,false],[false,false],[false,false]],"states":{"a":{"behaviour":"doorOpen","floor":1,"direction":"up","cabRequests":[false,false,false,false]},"b":{"behaviour":"idle","floor":1,"direction":"stop","cabRequests":[false,false,false,false]}}}`,
+		`{"a":[[false,false],[false,false],[false,false],[false,false]],"b":[[false,false],[true,false],[false,false],[false,false]]}`,
+	},
+	{
+		"no hall requests", "inDirn",
+		`{"hallRequests":[[false,false],[false,false],[false,false],[false,false]],"states":{"a":{"behaviour":"moving","floor":2,"direction":"down","cabRequests":[true,false,false,false]},"b":{"behaviour":"idle","floor":3,"direction":"stop","cabRequests":[false,false,false,false]}}}`,
+		`{"a":[[false,false],[false,false],[false,false],[false,false]],"b":[[false,false],[false,false],[false,false],[false,false]]}`,
+	},
+}
+
+func TestOptimalHallRequestsMatchesExecutable(t *testing.T) {
+	for _, tc := range goldenAssignments {
+		t.Run(tc.name, func(t *testing.T) {
+			var input struct {
+				HallRequests [][2]bool            `json:"hallRequests"`
+				States       map[string]ElevState `json:"states"`
+			}
+			if err := json.Unmarshal([]byte(tc.input), &input); err != nil {
+				t.Fatalf("input: %v", err)
+			}
+			var want map[string][][2]bool
+			if err := json.Unmarshal([]byte(tc.output), &want); err != nil {
+				t.Fatalf("output: %v", err)
+			}
+			config := AssignerConfig{
+				TravelDuration:   2500 * time.Millisecond,
+				DoorOpenDuration: 3000 * time.Millisecond,
+				ClearRequestType: tc.clearRequestType,
+			}
+			got, _ := OptimalHallRequests(input.HallRequests, input.States, config)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("assignment = %v, want %v", got, want)
+			}
+		})
+	}
+}
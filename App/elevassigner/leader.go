@@ -0,0 +1,62 @@
+package elevassigner
+
+import (
+	. "elevator/common"
+	"sort"
+	"time"
+)
+
+// Master/backup coordination: the alive node with the lowest id is the leader. It runs the
+// assigner for the whole group and shares the result in its snapshot; the others apply
+// their part of it. When the leader stops being alive, the next lowest id takes over.
+
+// Leader returns the id of the alive node with the lowest id, "" if none is alive.
+func Leader(alive map[string]bool) string {
+	ids := make([]string, 0, len(alive))
+	for id, ok := range alive {
+		if ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return ""
+	}
+	sort.Slice(ids, func(a, b int) bool { return KeyLess(ids[a], ids[b]) })
+	return ids[0]
+}
+
+// NewAssignment packs the leader's assignment for distribution.
+func NewAssignment(leader string, output map[string][][2]bool, etas [][2]time.Duration, parkFloors map[string]int) Assignment {
+	a := Assignment{
+		Leader:     leader,
+		HallTasks:  output,
+		HallETAsMs: make([][2]int64, len(etas)),
+		ParkFloors: parkFloors,
+	}
+	for f := range etas {
+		for c := range 2 {
+			a.HallETAsMs[f][c] = etas[f][c].Milliseconds()
+		}
+	}
+	return a
+}
+
+// InputFor extracts one elevator's part of a leader assignment. An elevator the leader
+// left out gets no hall requests.
+func InputFor(a Assignment, id string) ElevInput {
+	in := ElevInput{
+		HallTask:  make([][2]bool, N_FLOORS),
+		HallETA:   make([][2]time.Duration, N_FLOORS),
+		ParkFloor: -1,
+	}
+	copy(in.HallTask, a.HallTasks[id])
+	for f := 0; f < N_FLOORS && f < len(a.HallETAsMs); f++ {
+		for c := range 2 {
+			in.HallETA[f][c] = time.Duration(a.HallETAsMs[f][c]) * time.Millisecond
+		}
+	}
+	if f, ok := a.ParkFloors[id]; ok {
+		in.ParkFloor = f
+	}
+	return in
+}
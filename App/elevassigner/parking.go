@@ -0,0 +1,66 @@
+package elevassigner
+
+import (
+	. "elevator/common"
+	"sort"
+)
+
+// ParkingFloors picks a home floor for every elevator that has nothing to do: no cab
+// requests and no hall requests in assignment. Home floors are taken in the order given
+// (most important first), each by the nearest free elevator, so two elevators only share
+// a floor if it is listed twice. Elevators left without a home floor get -1. Every node computes the same result
+// from the same snapshot.
+func ParkingFloors(states map[string]ElevState, assignment map[string][][2]bool, homeFloors []int) map[string]int {
+	free := make([]string, 0, len(states))
+	result := make(map[string]int, len(states))
+	for id, st := range states {
+		result[id] = -1
+		if st.Floor >= 0 && st.Floor < N_FLOORS && !anyTrue(st.CabRequests) && !anyHall(assignment[id]) {
+			free = append(free, id)
+		}
+	}
+	sort.Strings(free)
+
+	for _, home := range homeFloors {
+		if home < 0 || home >= N_FLOORS {
+			continue
+		}
+		best := -1
+		for i, id := range free {
+			if best == -1 || floorDistance(states[id].Floor, home) < floorDistance(states[free[best]].Floor, home) {
+				best = i
+			}
+		}
+		if best == -1 {
+			break
+		}
+		result[free[best]] = home
+		free = append(free[:best], free[best+1:]...)
+	}
+	return result
+}
+
+func anyTrue(v []bool) bool {
+	for _, b := range v {
+		if b {
+			return true
+		}
+	}
+	return false
+}
+
+func anyHall(hall [][2]bool) bool {
+	for _, h := range hall {
+		if h[0] || h[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func floorDistance(a int, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
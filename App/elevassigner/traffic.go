@@ -0,0 +1,203 @@
+package elevassigner
+
+import (
+	. "elevator/common"
+	"time"
+)
+
+// Dispatch modes for the building's traffic pattern.
+//   - up-peak: most calls are up from the lobby; idle cars wait at the lobby.
+//   - down-peak: most calls are down towards the lobby; down calls are assigned first
+//     and idle cars wait on the upper floors.
+//   - inter-floor: no dominant pattern; plain assignment and the configured home floors.
+type TrafficMode int
+
+const (
+	TM_InterFloor TrafficMode = iota
+	TM_UpPeak
+	TM_DownPeak
+)
+
+func (m TrafficMode) String() string {
+	switch m {
+	case TM_UpPeak:
+		return "upPeak"
+	case TM_DownPeak:
+		return "downPeak"
+	default:
+		return "interFloor"
+	}
+}
+
+func TrafficModeFromString(s string) TrafficMode {
+	switch s {
+	case "upPeak":
+		return TM_UpPeak
+	case "downPeak":
+		return TM_DownPeak
+	default:
+		return TM_InterFloor
+	}
+}
+
+// Detection needs at least this many calls in the window to leave inter-floor mode.
+const trafficMinCalls = 8
+
+// Share of calls needed to enter a peak mode, and to stay in it (hysteresis).
+const (
+	trafficEnterShare = 0.6
+	trafficLeaveShare = 0.4
+)
+
+type hallCall struct {
+	floor  int
+	button ButtonType
+	at     time.Time
+}
+
+// CallHistory keeps the hall calls this node has seen appear over a sliding window and
+// derives the traffic mode from them.
+type CallHistory struct {
+	window time.Duration
+	calls  []hallCall
+	prev   [N_FLOORS][2]bool
+	mode   TrafficMode
+}
+
+func NewCallHistory(window time.Duration) *CallHistory {
+	return &CallHistory{window: window}
+}
+
+// Observe records the hall calls that are new since the previous snapshot.
+func (h *CallHistory) Observe(hallRequests [][2]bool, now time.Time) {
+	for f := 0; f < N_FLOORS && f < len(hallRequests); f++ {
+		for c := range 2 {
+			if hallRequests[f][c] && !h.prev[f][c] {
+				h.calls = append(h.calls, hallCall{floor: f, button: ButtonType(c), at: now})
+			}
+			h.prev[f][c] = hallRequests[f][c]
+		}
+	}
+	h.expire(now)
+}
+
+func (h *CallHistory) expire(now time.Time) {
+	keep := 0
+	for keep < len(h.calls) && now.Sub(h.calls[keep].at) > h.window {
+		keep++
+	}
+	h.calls = h.calls[keep:]
+}
+
+// Mode returns the scheduled mode if now falls within a period of the schedule, and the
+// mode detected from the call history otherwise.
+func (h *CallHistory) Mode(schedule []TrafficPeriod, lobby int, now time.Time) TrafficMode {
+	if mode, ok := scheduledMode(schedule, now); ok {
+		return mode
+	}
+	h.expire(now)
+	h.mode = detectMode(h.calls, lobby, h.mode)
+	return h.mode
+}
+
+func detectMode(calls []hallCall, lobby int, current TrafficMode) TrafficMode {
+	if len(calls) < trafficMinCalls {
+		return TM_InterFloor
+	}
+	up, down := 0, 0
+	for _, c := range calls {
+		switch {
+		case c.button == BT_HallUp && c.floor == lobby:
+			up++
+		case c.button == BT_HallDown:
+			down++
+		}
+	}
+	upShare := float64(up) / float64(len(calls))
+	downShare := float64(down) / float64(len(calls))
+
+	switch {
+	case current == TM_UpPeak && upShare >= trafficLeaveShare:
+		return TM_UpPeak
+	case current == TM_DownPeak && downShare >= trafficLeaveShare:
+		return TM_DownPeak
+	case upShare >= trafficEnterShare:
+		return TM_UpPeak
+	case downShare >= trafficEnterShare:
+		return TM_DownPeak
+	default:
+		return TM_InterFloor
+	}
+}
+
+func scheduledMode(schedule []TrafficPeriod, now time.Time) (TrafficMode, bool) {
+	minute := now.Hour()*60 + now.Minute()
+	for _, p := range schedule {
+		from, err1 := time.Parse("15:04", p.From)
+		to, err2 := time.Parse("15:04", p.To)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		start := from.Hour()*60 + from.Minute()
+		end := to.Hour()*60 + to.Minute()
+		inside := start <= minute && minute < end
+		if end < start {
+			inside = minute >= start || minute < end
+		}
+		if inside {
+			return TrafficModeFromString(p.Mode), true
+		}
+	}
+	return TM_InterFloor, false
+}
+
+// AssignHallRequests runs OptimalHallRequests adjusted for the traffic mode. In down-peak
+// the down calls are assigned first, as if the up calls did not exist, and the up calls
+// are then taken from an assignment of all calls.
+func AssignHallRequests(hallRequests [][2]bool, states map[string]ElevState, config AssignerConfig, mode TrafficMode) (map[string][][2]bool, [][2]time.Duration) {
+	if mode != TM_DownPeak {
+		return OptimalHallRequests(hallRequests, states, config)
+	}
+
+	downOnly := make([][2]bool, len(hallRequests))
+	for f := range hallRequests {
+		downOnly[f][BT_HallDown] = hallRequests[f][BT_HallDown]
+	}
+	result, etas := OptimalHallRequests(downOnly, states, config)
+	all, allETAs := OptimalHallRequests(hallRequests, states, config)
+	for id, hall := range all {
+		for f := range hall {
+			result[id][f][BT_HallUp] = hall[f][BT_HallUp]
+		}
+	}
+	for f := range allETAs {
+		etas[f][BT_HallUp] = allETAs[f][BT_HallUp]
+	}
+	return result, etas
+}
+
+// HomeFloorsForMode returns the home floors idle cars are parked at in the given mode:
+// the lobby for every car in up-peak, the upper floors from the top down in down-peak,
+// and the configured home floors otherwise.
+func HomeFloorsForMode(mode TrafficMode, homeFloors []int, lobby int, cars int) []int {
+	switch mode {
+	case TM_UpPeak:
+		homes := make([]int, cars)
+		for i := range homes {
+			homes[i] = lobby
+		}
+		return homes
+	case TM_DownPeak:
+		above := N_FLOORS - 1 - lobby
+		if above <= 0 {
+			return homeFloors
+		}
+		homes := make([]int, cars)
+		for i := range homes {
+			homes[i] = N_FLOORS - 1 - i%above
+		}
+		return homes
+	default:
+		return homeFloors
+	}
+}
@@ -0,0 +1,36 @@
+package elevfsm
+
+import (
+	"elevator/common"
+	"encoding/json"
+	"os"
+)
+
+// Cab requests are persisted on shutdown so they survive a restart of the program.
+
+// SaveCabRequests writes the cab requests to path.
+func SaveCabRequests(path string, cab []bool) error {
+	b, err := json.Marshal(cloneBoolSlice(cab))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// LoadCabRequests reads cab requests saved by SaveCabRequests and removes the file,
+// so a later crash does not bring back requests that have since been served.
+func LoadCabRequests(path string) ([]bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(path)
+	var cab []bool
+	if err := json.Unmarshal(b, &cab); err != nil {
+		return nil, err
+	}
+	if len(cab) != common.N_FLOORS {
+		cab = cloneBoolSlice(cab)
+	}
+	return cab, nil
+}
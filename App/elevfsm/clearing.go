@@ -0,0 +1,130 @@
+package elevfsm
+
+import (
+	"elevator/common"
+)
+
+// Request clearing policy, shared by the FSM (what the car clears when it stops) and
+// FsmSync (what is reported to the network as serviced).
+
+type ClearRequestVariant int
+
+const (
+	// Assume everyone waiting at the floor enters the elevator, regardless of direction.
+	CV_All ClearRequestVariant = iota
+	// Assume only those who want to travel in the current direction enter the elevator.
+	CV_InDirn
+)
+
+// ClearRequestVariantFromString maps the --clearRequestType values "all" and "inDirn".
+// Anything else falls back to CV_InDirn.
+func ClearRequestVariantFromString(s string) ClearRequestVariant {
+	if s == "all" {
+		return CV_All
+	}
+	return CV_InDirn
+}
+
+// ServicedAt tells which request types were cleared at a floor.
+type ServicedAt struct {
+	HallUp   bool
+	HallDown bool
+	Cab      bool
+}
+
+func requests_shouldClearImmediately(e Elevator, btn_floor int, btn_type common.ButtonType) int {
+	if e.full && btn_type != common.BT_Cab {
+		// nobody can get on; leave the hall call for another car
+		return 0
+	}
+	switch e.config.clearRequestVariant {
+	case CV_All:
+		if e.floor == btn_floor {
+			return 1
+		}
+		return 0
+
+	case CV_InDirn:
+		fallthrough
+	default:
+		if e.floor == btn_floor &&
+			((e.dirn == common.MD_Up && btn_type == common.BT_HallUp) ||
+				(e.dirn == common.MD_Down && btn_type == common.BT_HallDown) ||
+				e.dirn == common.MD_Stop ||
+				btn_type == common.BT_Cab) {
+			return 1
+		}
+		return 0
+	}
+}
+
+// requests_toClearAtCurrentFloor decides which requests at the current floor are served by stopping there.
+func requests_toClearAtCurrentFloor(e Elevator) ServicedAt {
+	here := e.requests[e.floor]
+	clear := ServicedAt{Cab: here[common.BT_Cab]}
+	if e.full {
+		return clear
+	}
+
+	switch e.config.clearRequestVariant {
+	case CV_All:
+		clear.HallUp = here[common.BT_HallUp]
+		clear.HallDown = here[common.BT_HallDown]
+
+	case CV_InDirn:
+		fallthrough
+	default:
+		switch e.dirn {
+		case common.MD_Up:
+			clear.HallUp = here[common.BT_HallUp]
+			if requests_above(e) == 0 && !here[common.BT_HallUp] {
+				clear.HallDown = here[common.BT_HallDown]
+			}
+
+		case common.MD_Down:
+			clear.HallDown = here[common.BT_HallDown]
+			if requests_below(e) == 0 && !here[common.BT_HallDown] {
+				clear.HallUp = here[common.BT_HallUp]
+			}
+
+		case common.MD_Stop:
+			fallthrough
+		default:
+			clear.HallUp = here[common.BT_HallUp]
+			clear.HallDown = here[common.BT_HallDown]
+		}
+	}
+	return clear
+}
+
+// requests_clearAtCurrentFloor clears the served requests and records them in e.served.
+func requests_clearAtCurrentFloor(e Elevator) Elevator {
+	clear := requests_toClearAtCurrentFloor(e)
+	if clear.Cab {
+		e.requests[e.floor][common.BT_Cab] = false
+		e.served.Cab = true
+	}
+	if clear.HallUp {
+		e.requests[e.floor][common.BT_HallUp] = false
+		e.served.HallUp = true
+	}
+	if clear.HallDown {
+		e.requests[e.floor][common.BT_HallDown] = false
+		e.served.HallDown = true
+	}
+	return e
+}
+
+// requests_markServed records a request that was served without being stored,
+// e.g. a press at the floor while the door is already open.
+func requests_markServed(e Elevator, btn_type common.ButtonType) Elevator {
+	switch btn_type {
+	case common.BT_HallUp:
+		e.served.HallUp = true
+	case common.BT_HallDown:
+		e.served.HallDown = true
+	case common.BT_Cab:
+		e.served.Cab = true
+	}
+	return e
+}
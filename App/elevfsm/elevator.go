@@ -12,14 +12,45 @@ const (
 	EB_Idle = iota
 	EB_DoorOpen
 	EB_Moving
+	EB_EmergencyStop
 )
 
 // structs
+type ElevatorConfig struct {
+	clearRequestVariant ClearRequestVariant
+	maintenanceFloor    int // where to park with doors open in maintenance, -1 to stay put
+	fullLoad            int // load in percent from which the car takes no more passengers
+	recallFloor         int // where all cars go in fire-service recall
+}
+
 type Elevator struct {
 	floor     int
 	dirn      common.MotorDirection
 	behaviour ElevatorBehaviour
 	requests  [common.N_FLOORS][common.N_BUTTONS]bool
+
+	obstructed         bool
+	atFloorWhenStopped bool
+	motorFailure       bool
+	obstructionFault   bool
+
+	// requests cleared at the current floor since the last door cycle completed
+	served ServicedAt
+
+	load int  // percent of capacity
+	full bool // load at or above config.fullLoad: hall requests are skipped
+
+	maintenance  bool
+	recall       bool // fire-service recall: no requests, go to the recall floor and stay there
+	parkFloor    int  // floor to go to when there is nothing else to do, -1 for none
+	parkDoorOpen bool // hold the door open once parked
+	parking      bool // moving only to reach parkFloor
+	parked       bool // parked with the door held open, no door timer running
+
+	config ElevatorConfig
+
+	// adapter state: run by fsm_apply from the door timer commands, never read by Transition
+	doorTimer DoorTimer
 }
 
 // functions
@@ -28,5 +59,8 @@ func elevator_uninitialized() Elevator {
 	elevator.floor = -1
 	elevator.dirn = common.MD_Stop
 	elevator.behaviour = EB_Idle
+	elevator.parkFloor = -1
+	elevator.config.clearRequestVariant = CV_InDirn
+	elevator.config.maintenanceFloor = -1
 	return elevator
 }
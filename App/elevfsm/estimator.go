@@ -0,0 +1,106 @@
+package elevfsm
+
+import (
+	"time"
+)
+
+// How much a new sample moves the rolling estimate.
+const estimateWeight = 0.2
+
+// Estimates are only re-published when they move by at least this much.
+const estimateReportStep = 100 * time.Millisecond
+
+// DurationEstimator keeps rolling estimates of this car's floor-to-floor travel time and
+// door cycle time, measured from the FSM as it runs. The estimates are shared with the
+// group so the assigner can account for slower cars.
+type DurationEstimator struct {
+	travel   time.Duration
+	doorOpen time.Duration
+
+	reportedTravel   time.Duration
+	reportedDoorOpen time.Duration
+
+	prevBehaviour ElevatorBehaviour
+	departedAt    time.Time
+	legFailed     bool
+	doorOpenedAt  time.Time
+	doorTainted   bool
+}
+
+func NewDurationEstimator(travel time.Duration, doorOpen time.Duration) *DurationEstimator {
+	return &DurationEstimator{
+		travel:           travel,
+		doorOpen:         doorOpen,
+		reportedTravel:   travel,
+		reportedDoorOpen: doorOpen,
+		prevBehaviour:    EB_Idle,
+	}
+}
+
+// Observe advances the estimator for one poll. arrived reports whether a floor arrival
+// was handled during this poll. Returns true when the estimates moved enough to be re-published.
+func (d *DurationEstimator) Observe(e *Elevator, arrived bool, now time.Time) bool {
+	// Travel: from leaving a floor (or passing one) to the next arrival.
+	if e.motorFailure || e.behaviour == EB_EmergencyStop {
+		d.legFailed = true
+	}
+	if arrived {
+		if !d.departedAt.IsZero() && !d.legFailed && e.floor != -1 {
+			d.travel = blend(d.travel, now.Sub(d.departedAt))
+		}
+		d.departedAt = time.Time{}
+		if e.behaviour == EB_Moving {
+			d.departedAt = now
+			d.legFailed = false
+		}
+	} else if e.behaviour == EB_Moving && d.prevBehaviour != EB_Moving {
+		d.departedAt = now
+		// a leg starting between floors (init or stop release) is not a full floor-to-floor trip
+		d.legFailed = d.prevBehaviour == EB_EmergencyStop || e.floor == -1
+	}
+
+	// Door: from entering DoorOpen to leaving it, skipping obstructed or interrupted cycles.
+	if e.behaviour == EB_DoorOpen && d.prevBehaviour != EB_DoorOpen {
+		d.doorOpenedAt = now
+		d.doorTainted = false
+	}
+	if e.behaviour == EB_DoorOpen && (e.obstructed || e.parked) {
+		d.doorTainted = true
+	}
+	if e.behaviour != EB_DoorOpen && d.prevBehaviour == EB_DoorOpen {
+		if !d.doorOpenedAt.IsZero() && !d.doorTainted && e.behaviour != EB_EmergencyStop {
+			d.doorOpen = blend(d.doorOpen, now.Sub(d.doorOpenedAt))
+		}
+		d.doorOpenedAt = time.Time{}
+	}
+	d.prevBehaviour = e.behaviour
+
+	if absDuration(d.travel-d.reportedTravel) >= estimateReportStep ||
+		absDuration(d.doorOpen-d.reportedDoorOpen) >= estimateReportStep {
+		d.reportedTravel = d.travel
+		d.reportedDoorOpen = d.doorOpen
+		return true
+	}
+	return false
+}
+
+// TravelDuration is the current floor-to-floor travel time estimate.
+func (d *DurationEstimator) TravelDuration() time.Duration {
+	return d.travel
+}
+
+// DoorOpenDuration is the current door cycle time estimate.
+func (d *DurationEstimator) DoorOpenDuration() time.Duration {
+	return d.doorOpen
+}
+
+func blend(estimate time.Duration, sample time.Duration) time.Duration {
+	return time.Duration((1-estimateWeight)*float64(estimate) + estimateWeight*float64(sample))
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -2,101 +2,124 @@ package elevfsm
 
 import (
 	"elevator/common"
+	"log"
+	"time"
 )
 
 var outputDevice common.ElevOutputDevice
 
-func Fsm_init() (elevator *Elevator) {
+func Fsm_init(cfg common.Config) (elevator *Elevator) {
 	e := new(Elevator)
-	*e = elevator_uninitialized()
+	*e = NewElevator(cfg)
 
+	e.doorTimer = DoorTimer{duration: cfg.DoorOpenDuration}
 	outputDevice = common.ElevioGetOutputDevice()
 	outputDevice.DoorLight(false)
 
 	return e
 }
-
 func Fsm_onInitBetweenFloors(e *Elevator) {
-	outputDevice.MotorDirection(common.MD_Down)
-	e.dirn = common.MD_Down
-	e.behaviour = EB_Moving
+	fsm_apply(e, Event{Kind: EV_InitBetweenFloors})
 }
 
 func Fsm_onRequestButtonPress(e *Elevator, btn_floor int, btn_type common.ButtonType) {
+	fsm_apply(e, Event{Kind: EV_RequestButtonPress, Floor: btn_floor, Button: btn_type})
+}
 
-	switch e.behaviour {
-	case EB_DoorOpen:
-		if requests_shouldClearImmediately(*e, btn_floor, btn_type) != 0 {
-			// timer is handled by the fsm thread; no-op here
-		} else {
-			e.requests[btn_floor][btn_type] = true
-		}
+func Fsm_onFloorArrival(e *Elevator, newFloor int) {
+	if e.motorFailure {
+		log.Printf("fsmThread: reached floor %d, motor recovered", newFloor)
+	}
+	fsm_apply(e, Event{Kind: EV_FloorArrival, Floor: newFloor})
+}
 
-	case EB_Moving:
+func Fsm_onDoorTimeout(e *Elevator) {
+	fsm_apply(e, Event{Kind: EV_DoorTimeout})
+}
 
-		e.requests[btn_floor][btn_type] = true
+// Fsm_onObstruction is called when the obstruction switch changes.
+func Fsm_onObstruction(e *Elevator, obstructed bool) {
+	fsm_apply(e, Event{Kind: EV_Obstruction, On: obstructed})
+}
 
-	case EB_Idle:
-		e.requests[btn_floor][btn_type] = true
-		pair := requests_chooseDirection(*e)
-		e.dirn = pair.dirn
-		e.behaviour = pair.behaviour
+// Fsm_pollDoorTimer delivers a door timeout if the door timer has expired. Returns true
+// when the door-open period completed, i.e. the requests at the floor have been served.
+func Fsm_pollDoorTimer(e *Elevator, now time.Time) bool {
+	if !e.doorTimer.TimedOut(now) {
+		return false
+	}
+	e.doorTimer.Stop()
+	completed := e.behaviour == EB_DoorOpen && !e.obstructed
+	Fsm_onDoorTimeout(e)
+	return completed
+}
 
-		switch pair.behaviour {
-		case EB_DoorOpen:
-			outputDevice.DoorLight(true)
-			*e = requests_clearAtCurrentFloor(*e) //TODO: Bro we have same function in fsmsync. Make it one, make it snappy.
+// Fsm_onStopButtonPress halts the car immediately and lights the stop lamp.
+// Stop is ignored until the elevator has reached a defined floor after init.
+func Fsm_onStopButtonPress(e *Elevator, atFloor bool) {
+	fsm_apply(e, Event{Kind: EV_StopButtonPress, AtFloor: atFloor})
+}
 
-		case EB_Moving:
-			outputDevice.MotorDirection(e.dirn)
+// Fsm_onStopButtonRelease resumes normal operation. Remaining requests (typically
+// cab calls, as hall calls are reassigned while stopped) are served as usual.
+func Fsm_onStopButtonRelease(e *Elevator) {
+	fsm_apply(e, Event{Kind: EV_StopButtonRelease})
+}
 
-		case EB_Idle:
-			// do nothing
-		}
-	}
+// Fsm_onMaintenance takes the car out of (or back into) service.
+func Fsm_onMaintenance(e *Elevator, on bool) {
+	fsm_apply(e, Event{Kind: EV_Maintenance, On: on})
 }
 
-func Fsm_onFloorArrival(e *Elevator, newFloor int) {
+// Fsm_onPark sends an idle car to the given home floor (-1 withdraws it).
+func Fsm_onPark(e *Elevator, floor int) {
+	fsm_apply(e, Event{Kind: EV_Park, Floor: floor})
+}
 
-	e.floor = newFloor
-	outputDevice.FloorIndicator(e.floor)
+// Fsm_onLoad reports the measured car load in percent of capacity.
+func Fsm_onLoad(e *Elevator, load int) {
+	fsm_apply(e, Event{Kind: EV_Load, Load: load})
+}
 
-	switch e.behaviour {
-	case EB_Moving:
-		if requests_shouldStop(*e) != 0 {
-			outputDevice.MotorDirection(common.MD_Stop)
-			outputDevice.DoorLight(true)
-			*e = requests_clearAtCurrentFloor(*e)
-			// timer is handled by the fsm thread; no-op here
-			//SetAllLights(*e)
-			e.behaviour = EB_DoorOpen
-		}
-	default:
-		// do nothing
-	}
+// CarLoad is the last reported car load in percent of capacity.
+func CarLoad(e *Elevator) int {
+	return e.load
+}
 
+// CarFull reports whether the car is too full to take hall requests.
+func CarFull(e *Elevator) bool {
+	return e.full
 }
 
-func Fsm_onDoorTimeout(e *Elevator) {
+// Fsm_onRecall starts or ends fire-service recall.
+func Fsm_onRecall(e *Elevator, on bool) {
+	fsm_apply(e, Event{Kind: EV_Recall, On: on})
+}
 
-	switch e.behaviour {
-	case EB_DoorOpen:
-		pair := requests_chooseDirection(*e)
-		e.dirn = pair.dirn
-		e.behaviour = pair.behaviour
-
-		switch e.behaviour {
-		case EB_DoorOpen:
-			// timer is handled by the fsm thread; no-op here
-			*e = requests_clearAtCurrentFloor(*e)
-			//SetAllLights(*e)
-
-		case EB_Moving, EB_Idle:
-			outputDevice.DoorLight(false)
-			outputDevice.MotorDirection(e.dirn)
+// Fsm_onShutdown stops the car and closes the door before the program exits.
+func Fsm_onShutdown(e *Elevator) {
+	fsm_apply(e, Event{Kind: EV_Shutdown})
+}
+
+// fsm_apply runs the transition for an event and performs its commands on the output device.
+func fsm_apply(e *Elevator, ev Event) {
+	next, cmds := Transition(*e, ev)
+	*e = next
+	for _, cmd := range cmds {
+		switch cmd.Kind {
+		case CMD_SetMotor:
+			outputDevice.MotorDirection(cmd.Motor)
+		case CMD_SetDoorLamp:
+			outputDevice.DoorLight(cmd.On)
+		case CMD_SetStopLamp:
+			outputDevice.StopButtonLight(cmd.On)
+		case CMD_SetFloorIndicator:
+			outputDevice.FloorIndicator(cmd.Floor)
+		case CMD_StartDoorTimer:
+			e.doorTimer.Start(time.Now())
+		case CMD_StopDoorTimer:
+			e.doorTimer.Stop()
 		}
-	default:
-		// do nothing
 	}
 }
 
@@ -116,6 +139,8 @@ func CurrentMotionStrings(e *Elevator) (behavior string, direction string) {
 		behavior = "doorOpen"
 	case EB_Moving:
 		behavior = "moving"
+	case EB_EmergencyStop:
+		behavior = "emergencyStop"
 	default:
 		behavior = "idle"
 	}
@@ -9,12 +9,6 @@ import (
 // Allow a few missed snapshots before declaring offline.
 const netOfflineTimeout = 5 * time.Second
 
-type ServicedAt struct {
-	HallUp   bool
-	HallDown bool
-	Cab      bool
-}
-
 type FsmSync struct {
 	cfg     common.Config
 	selfKey string
@@ -27,10 +21,19 @@ type FsmSync struct {
 
 	assignedHall [][2]bool
 	hasAssigner  bool
+	hallETA      [common.N_FLOORS][2]time.Time // predicted arrival for our assigned halls
 
 	localHall [][2]bool
 	localCab  []bool
 
+	// cab requests cancelled here, masked in the network view until it drops them too
+	cabCancelled [common.N_FLOORS]bool
+
+	// destination dispatch calls, [from][to]
+	netDest       [][]bool
+	localDest     [][]bool
+	destConfirmed [common.N_FLOORS][common.N_FLOORS]bool
+
 	pendingAt [common.N_FLOORS][common.N_BUTTONS]time.Time
 	injected  [common.N_FLOORS][common.N_BUTTONS]bool
 	confirmed [common.N_FLOORS][common.N_BUTTONS]bool
@@ -39,6 +42,9 @@ type FsmSync struct {
 	reportedBehavior  string
 	reportedDirection string
 
+	travelDuration   time.Duration
+	doorOpenDuration time.Duration
+
 	Elevator *Elevator
 }
 
@@ -51,6 +57,8 @@ func NewFsmSync(cfg common.Config) *FsmSync {
 		netCab:        make([]bool, common.N_FLOORS),
 		localHall:     make([][2]bool, common.N_FLOORS),
 		localCab:      make([]bool, common.N_FLOORS),
+		netDest:       common.NewDestinations(),
+		localDest:     common.NewDestinations(),
 		assignedHall:  make([][2]bool, common.N_FLOORS),
 		reportedFloor: -1,
 	}
@@ -86,7 +94,8 @@ func (s *FsmSync) LocalCabCopy() []bool {
 }
 
 // ApplyAssigner stores hall assignments and cancels any previously assigned halls that were removed.
-func (s *FsmSync) ApplyAssigner(task common.ElevInput) {
+// Returns true when the set of ETAs we report changed.
+func (s *FsmSync) ApplyAssigner(task common.ElevInput, now time.Time) bool {
 	if s.assignedHall == nil || len(s.assignedHall) != common.N_FLOORS {
 		s.assignedHall = make([][2]bool, common.N_FLOORS)
 	}
@@ -94,6 +103,54 @@ func (s *FsmSync) ApplyAssigner(task common.ElevInput) {
 	copyHall(s.assignedHall, task.HallTask)
 	s.hasAssigner = true
 	s.cancelUnassigned(previousAssignment)
+	return s.updateETAs(task.HallETA, now)
+}
+
+// updateETAs fixes the predicted arrival of each hall when it is first assigned to us, so it can
+// later be compared with the actual service time. Halls no longer assigned to us drop their ETA.
+func (s *FsmSync) updateETAs(etas [][2]time.Duration, now time.Time) bool {
+	changed := false
+	for f := range common.N_FLOORS {
+		for c := range 2 {
+			if !s.assignedHall[f][c] {
+				if !s.hallETA[f][c].IsZero() {
+					s.hallETA[f][c] = time.Time{}
+					changed = true
+				}
+				continue
+			}
+			if s.hallETA[f][c].IsZero() && f < len(etas) {
+				s.hallETA[f][c] = now.Add(etas[f][c])
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// SetRecall starts or ends fire-service recall. Hall calls are dropped; cab calls are kept
+// but withheld from the FSM until the recall ends, when they are injected again.
+func (s *FsmSync) SetRecall(on bool) {
+	Fsm_onRecall(s.Elevator, on)
+	if !on {
+		return
+	}
+	s.DropHallCalls()
+	for f := range common.N_FLOORS {
+		s.injected[f][common.BT_Cab] = false
+	}
+}
+
+// DropHallCalls gives up every hall request this node holds, e.g. when shutting down.
+// Hall requests are only taken again after a new assignment.
+func (s *FsmSync) DropHallCalls() {
+	for f := range common.N_FLOORS {
+		s.cancelHall(f, common.BT_HallUp)
+		s.cancelHall(f, common.BT_HallDown)
+		s.assignedHall[f] = [2]bool{false, false}
+		s.hallETA[f] = [2]time.Time{}
+	}
+	s.hasAssigner = true
 }
 
 // cancelUnassigned clears local tracking for halls we no longer own after a new assignment.
@@ -120,7 +177,7 @@ func (s *FsmSync) cancelHall(f int, btn common.ButtonType) {
 		return
 	}
 	if s.injected[f][btn] || !s.pendingAt[f][btn].IsZero() || s.localHall[f][btn] {
-		log.Printf("fsmThread:  hall unassigned f=%d b=%s (%s)", f, common.ElevioButtonToString(btn))
+		log.Printf("fsmThread:  hall unassigned f=%d b=%s", f, common.ElevioButtonToString(btn))
 	}
 	s.pendingAt[f][btn] = time.Time{}
 	s.injected[f][btn] = false
@@ -143,6 +200,7 @@ func (s *FsmSync) ApplyNetworkSnapshot(snap common.Snapshot, now time.Time) {
 	if s.copyCabFromSnapshot(snap) {
 		s.hasNetSelf = true
 	}
+	s.applyNetDestinations(snap.DestinationRequests)
 	for f := range common.N_FLOORS {
 		for btn := range common.ButtonType(common.N_BUTTONS) {
 			wasConfirmed := s.confirmed[f][btn]
@@ -159,7 +217,7 @@ func (s *FsmSync) ApplyNetworkSnapshot(snap common.Snapshot, now time.Time) {
 				if btn == common.BT_Cab {
 					s.localCab[f] = true
 				}
-				return
+				continue
 			}
 			s.confirmed[f][btn] = false
 			if wasConfirmed {
@@ -174,6 +232,54 @@ func (s *FsmSync) ApplyNetworkSnapshot(snap common.Snapshot, now time.Time) {
 	}
 }
 
+// applyNetDestinations takes the shared destination calls. A local call is dropped once the
+// network has confirmed it and then removed it (it was picked up).
+func (s *FsmSync) applyNetDestinations(dest [][]bool) {
+	if dest == nil {
+		return
+	}
+	for from := range common.N_FLOORS {
+		for to := range common.N_FLOORS {
+			s.netDest[from][to] = from < len(dest) && to < len(dest[from]) && dest[from][to]
+			if s.netDest[from][to] {
+				s.destConfirmed[from][to] = true
+			} else if s.destConfirmed[from][to] {
+				s.destConfirmed[from][to] = false
+				s.localDest[from][to] = false
+			}
+		}
+	}
+}
+
+// OnDestinationPress records a destination call from a hall keypad. It raises the hall
+// request at "from" in the direction of travel, which is assigned and served as usual.
+func (s *FsmSync) OnDestinationPress(from int, to int, now time.Time) {
+	if from == to || from < 0 || to < 0 || from >= common.N_FLOORS || to >= common.N_FLOORS {
+		return
+	}
+	s.localDest[from][to] = true
+	s.OnLocalPress(from, common.DestinationButton(from, to), now)
+}
+
+// PickUpDestinations registers the cab calls for the destination calls picked up with the
+// hall requests served at floor f, as if the passengers pressed them on boarding.
+func (s *FsmSync) PickUpDestinations(f int, served ServicedAt, now time.Time) {
+	if f < 0 || f >= common.N_FLOORS {
+		return
+	}
+	for to := range common.N_FLOORS {
+		if !s.netDest[f][to] && !s.localDest[f][to] {
+			continue
+		}
+		btn := common.DestinationButton(f, to)
+		if (btn == common.BT_HallUp && served.HallUp) || (btn == common.BT_HallDown && served.HallDown) {
+			log.Printf("fsmThread: picked up destination call %d -> %d", f, to)
+			s.localDest[f][to] = false
+			s.OnLocalPress(to, common.BT_Cab, now)
+		}
+	}
+}
+
 // copyCabFromSnapshot extracts our own cab requests from a snapshot (per-elevator state).
 func (s *FsmSync) copyCabFromSnapshot(snapshot common.Snapshot) bool {
 	for floor := range common.N_FLOORS {
@@ -189,11 +295,47 @@ func (s *FsmSync) copyCabFromSnapshot(snapshot common.Snapshot) bool {
 	for floor := 0; floor < common.N_FLOORS && floor < len(state.CabRequests); floor++ {
 		s.netCab[floor] = state.CabRequests[floor]
 	}
+	for floor := range common.N_FLOORS {
+		if !s.cabCancelled[floor] {
+			continue
+		}
+		if s.netCab[floor] {
+			s.netCab[floor] = false
+		} else {
+			s.cabCancelled[floor] = false
+		}
+	}
 	return true
 }
 
+// CabActive reports whether there is a cab request at floor f, pending or confirmed.
+func (s *FsmSync) CabActive(f int) bool {
+	return s.localCab[f] || s.netCab[f] || !s.pendingAt[f][common.BT_Cab].IsZero()
+}
+
+// CancelCab withdraws the cab request at floor f, e.g. after a double press. It is removed
+// from the FSM and from our replicated state; until the network view has dropped it too,
+// it is masked there so it is neither re-injected nor recovered.
+func (s *FsmSync) CancelCab(f int) {
+	if f < 0 || f >= common.N_FLOORS {
+		return
+	}
+	log.Printf("fsmThread: cab request f=%d cancelled", f)
+	s.pendingAt[f][common.BT_Cab] = time.Time{}
+	s.injected[f][common.BT_Cab] = false
+	s.confirmed[f][common.BT_Cab] = false
+	s.localCab[f] = false
+	s.netCab[f] = false
+	s.cabCancelled[f] = true
+
+	s.Elevator.requests[f][common.BT_Cab] = false
+}
+
 // OnLocalPress records a local button press and marks it pending confirmation/injection.
 func (s *FsmSync) OnLocalPress(f int, btn common.ButtonType, now time.Time) {
+	if btn == common.BT_Cab {
+		s.cabCancelled[f] = false
+	}
 	s.markPending(f, btn, now)
 	switch btn {
 	case common.BT_HallUp:
@@ -248,7 +390,11 @@ func (s *FsmSync) TryInjectAll(now time.Time, confirmTimeout time.Duration, onli
 			hasRequest := (btn == common.BT_Cab && cab[f]) ||
 				(btn != common.BT_Cab && hall[f][btn])
 
-			if !hasRequest || s.injected[f][btn] {
+			if !hasRequest || s.injected[f][btn] || s.Elevator.recall {
+				continue
+			}
+			// out of service: hall calls are left to the other elevators, even offline
+			if btn != common.BT_Cab && s.Elevator.maintenance {
 				continue
 			}
 
@@ -273,17 +419,21 @@ func (s *FsmSync) TryInjectAll(now time.Time, confirmTimeout time.Duration, onli
 	}
 }
 
-// ClearAtFloor clears injected requests serviced at a floor and returns which types were cleared.
+// ClearAtFloor reports the injected requests the FSM served at a floor during the door cycle
+// that just completed. It uses exactly what the FSM cleared, so the serviced report matches
+// the configured clearing policy.
 // When online, keep injected flags until the network snapshot removes the requests.
 // When offline, clear injected flags immediately.
-func (s *FsmSync) ClearAtFloor(f int, online bool, arrivalDirn common.MotorDirection) ServicedAt {
+func (s *FsmSync) ClearAtFloor(f int, online bool) ServicedAt {
+	served := s.Elevator.served
+	s.Elevator.served = ServicedAt{}
 	if f < 0 || f >= common.N_FLOORS {
 		return ServicedAt{}
 	}
 
 	var cleared ServicedAt
 
-	if s.injected[f][common.BT_Cab] {
+	if served.Cab && s.injected[f][common.BT_Cab] {
 		cleared.Cab = true
 		s.localCab[f] = false
 		if !online {
@@ -291,40 +441,30 @@ func (s *FsmSync) ClearAtFloor(f int, online bool, arrivalDirn common.MotorDirec
 		}
 	}
 
-	var clearUp, clearDown bool
-
-	switch arrivalDirn {
-	case common.MD_Up:
-		clearUp = true
-		if s.Elevator.floor == common.N_FLOORS-1 || (requests_above(*s.Elevator) == 0 && !s.Elevator.requests[s.Elevator.floor][common.BT_HallUp]) {
-			clearDown = true
-		}
-	case common.MD_Down:
-		clearDown = true
-		if s.Elevator.floor == 0 || (requests_below(*s.Elevator) == 0 && !s.Elevator.requests[s.Elevator.floor][common.BT_HallDown]) {
-			clearUp = true
-		}
-	case common.MD_Stop:
-		clearUp, clearDown = true, true
-	}
-
 	// helper to apply hall clears concisely
-	applyHallClear := func(btn common.ButtonType, idx int, mark *bool, setCleared func()) {
-		if *mark && s.injected[f][btn] {
+	applyHallClear := func(btn common.ButtonType, idx int, mark bool, setCleared func()) {
+		if mark && s.injected[f][btn] {
 			setCleared()
 			s.localHall[f][idx] = false
+			s.hallETA[f][idx] = time.Time{}
 			if !online {
 				s.injected[f][btn] = false
 			}
 		}
 	}
 
-	applyHallClear(common.BT_HallUp, 0, &clearUp, func() { cleared.HallUp = true })
-	applyHallClear(common.BT_HallDown, 1, &clearDown, func() { cleared.HallDown = true })
+	applyHallClear(common.BT_HallUp, 0, served.HallUp, func() { cleared.HallUp = true })
+	applyHallClear(common.BT_HallDown, 1, served.HallDown, func() { cleared.HallDown = true })
 
 	return cleared
 }
 
+// SetDurationEstimates stores the measured travel and door durations reported in our ElevState.
+func (s *FsmSync) SetDurationEstimates(travel time.Duration, doorOpen time.Duration) {
+	s.travelDuration = travel
+	s.doorOpenDuration = doorOpen
+}
+
 func (s *FsmSync) BuildSnapshot(floor int, behavior string, direction string, kind common.UpdateKind, cleared ServicedAt, online bool) common.Snapshot {
 
 	// Choose base hall source
@@ -347,19 +487,68 @@ func (s *FsmSync) BuildSnapshot(floor int, behavior string, direction string, ki
 		}
 	}
 
+	// Destination calls follow the hall requests they raised
+	baseDest := s.localDest
+	if kind == common.UpdateServiced && online && s.hasNet {
+		baseDest = s.netDest
+	}
+	outDest := common.CopyDestinations(baseDest)
+	if kind == common.UpdateServiced && floor >= 0 && floor < len(outDest) {
+		for to := range outDest[floor] {
+			btn := common.DestinationButton(floor, to)
+			if (btn == common.BT_HallUp && cleared.HallUp) || (btn == common.BT_HallDown && cleared.HallDown) {
+				outDest[floor][to] = false
+			}
+		}
+	}
+
 	return common.Snapshot{
-		HallRequests: outHall,
+		HallRequests:        outHall,
+		DestinationRequests: outDest,
 		States: map[string]common.ElevState{
 			s.selfKey: {
-				Behavior:    behavior,
-				Floor:       floor,
-				Direction:   direction,
-				CabRequests: cloneBoolSlice(s.localCab),
+				Behavior:         behavior,
+				Floor:            floor,
+				Direction:        direction,
+				CabRequests:      cloneBoolSlice(s.localCab),
+				CabCancelled:     s.cabCancelledSlice(),
+				MotorFailure:     s.Elevator.motorFailure,
+				ObstructionFault: s.Elevator.obstructionFault,
+				Maintenance:      s.Elevator.maintenance,
+				Load:             s.Elevator.load,
+				Full:             s.Elevator.full,
+
+				TravelDurationMs:   int(s.travelDuration.Milliseconds()),
+				DoorOpenDurationMs: int(s.doorOpenDuration.Milliseconds()),
+				HallETAs:           s.hallETAsUnixMilli(),
 			},
 		},
 		UpdateKind: kind,
 	}
 }
+
+// cabCancelledSlice returns the pending cab cancellations, nil if there are none.
+func (s *FsmSync) cabCancelledSlice() []bool {
+	for f := range common.N_FLOORS {
+		if s.cabCancelled[f] {
+			return cloneBoolSlice(s.cabCancelled[:])
+		}
+	}
+	return nil
+}
+
+// hallETAsUnixMilli returns our hall ETAs as unix milliseconds, 0 where none is set.
+func (s *FsmSync) hallETAsUnixMilli() [][2]int64 {
+	out := make([][2]int64, common.N_FLOORS)
+	for f := range common.N_FLOORS {
+		for c := range 2 {
+			if !s.hallETA[f][c].IsZero() {
+				out[f][c] = s.hallETA[f][c].UnixMilli()
+			}
+		}
+	}
+	return out
+}
 // ApplyLights drives the physical lamps from a snapshot's hall and cab requests.
 func (s *FsmSync) ApplyLights(online bool) {
 	hall := make([][2]bool, common.N_FLOORS)
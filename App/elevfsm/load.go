@@ -0,0 +1,50 @@
+package elevfsm
+
+import (
+	"elevator/common"
+	"math/rand"
+)
+
+// LoadSimulator stands in for a load sensor: passengers board at hall stops and leave
+// at cab stops. Loads are in percent of capacity.
+type LoadSimulator struct {
+	rng  *rand.Rand
+	load int
+}
+
+func NewLoadSimulator(seed int64) *LoadSimulator {
+	return &LoadSimulator{rng: rand.New(rand.NewSource(seed))}
+}
+
+// Observe updates the load after a door cycle that served the given requests.
+// Returns the new load and whether it changed.
+func (l *LoadSimulator) Observe(e *Elevator, served ServicedAt) (int, bool) {
+	load := l.load
+	if served.Cab {
+		load -= 10 + l.rng.Intn(30)
+	}
+	if served.HallUp {
+		load += 10 + l.rng.Intn(30)
+	}
+	if served.HallDown {
+		load += 10 + l.rng.Intn(30)
+	}
+	if !anyCabRequest(e) && !served.HallUp && !served.HallDown {
+		// nobody left to drop off
+		load = 0
+	}
+	load = max(0, min(load, 100))
+
+	changed := load != l.load
+	l.load = load
+	return load, changed
+}
+
+func anyCabRequest(e *Elevator) bool {
+	for f := range e.requests {
+		if e.requests[f][common.BT_Cab] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package elevfsm
+
+import (
+	"elevator/common"
+	"time"
+)
+
+// Parking: a car with nothing to do travels to a park floor on its own. Normally the park
+// floor is the home floor handed out by the assigner, set once the car has been idle for a
+// while (see ParkingPolicy) and dropped on arrival or when a request comes in. In
+// maintenance it is the configured maintenance floor and in fire recall the recall floor;
+// the door is held open there.
+
+// parking_start sets an idle car off towards its park floor, or parks it if it is already there.
+func parking_start(e Elevator, cmds []Command) (Elevator, []Command) {
+	if e.behaviour != EB_Idle || e.parkFloor < 0 || e.floor < 0 || requests_any(e) {
+		return e, cmds
+	}
+	if e.floor == e.parkFloor {
+		return parking_arrive(e, cmds)
+	}
+	e.dirn = parking_direction(e)
+	e.behaviour = EB_Moving
+	e.parking = true
+	return e, append(cmds, SetMotor(e.dirn))
+}
+
+// parking_continue decides what to do at each floor passed on the way to the park floor.
+// Any request ends the trip at once and is served as usual.
+func parking_continue(e Elevator, cmds []Command) (Elevator, []Command) {
+	if requests_any(e) {
+		e.parking = false
+		if !parking_fixed(e) {
+			e.parkFloor = -1
+		}
+		pair := requests_chooseDirection(e)
+		e.dirn = pair.dirn
+		e.behaviour = pair.behaviour
+		switch pair.behaviour {
+		case EB_DoorOpen:
+			cmds = append(cmds, SetMotor(common.MD_Stop), SetDoorLamp(true), StartDoorTimer())
+			e = requests_clearAtCurrentFloor(e)
+		case EB_Moving, EB_Idle:
+			cmds = append(cmds, SetMotor(e.dirn))
+		}
+		return e, cmds
+	}
+	if e.parkFloor < 0 {
+		// park floor withdrawn on the way: stop here
+		e.parking = false
+		e.dirn = common.MD_Stop
+		e.behaviour = EB_Idle
+		return e, append(cmds, SetMotor(common.MD_Stop))
+	}
+	if e.floor == e.parkFloor {
+		return parking_arrive(e, cmds)
+	}
+	if dirn := parking_direction(e); dirn != e.dirn {
+		// park floor moved behind us
+		e.dirn = dirn
+		cmds = append(cmds, SetMotor(dirn))
+	}
+	return e, cmds
+}
+
+// parking_interrupt ends a trip to the park floor as soon as a request comes in, heading
+// for the request instead. A request at the floor just left turns the car back to it.
+func parking_interrupt(e Elevator, cmds []Command) (Elevator, []Command) {
+	if !requests_any(e) {
+		return e, cmds
+	}
+	e.parking = false
+	if !parking_fixed(e) {
+		e.parkFloor = -1
+	}
+	pair := requests_chooseDirection(e)
+	if pair.behaviour == EB_DoorOpen {
+		pair = DirnBehaviourPair{-e.dirn, EB_Moving}
+	}
+	if pair.behaviour == EB_Moving && pair.dirn != e.dirn {
+		e.dirn = pair.dirn
+		cmds = append(cmds, SetMotor(e.dirn))
+	}
+	return e, cmds
+}
+
+// parking_arrive stops the car at its park floor.
+func parking_arrive(e Elevator, cmds []Command) (Elevator, []Command) {
+	e.parking = false
+	e.dirn = common.MD_Stop
+	cmds = append(cmds, SetMotor(common.MD_Stop))
+	if !parking_fixed(e) {
+		e.parkFloor = -1
+	}
+	if e.parkDoorOpen {
+		e.behaviour = EB_DoorOpen
+		e.parked = true
+		return e, append(cmds, SetDoorLamp(true), StopDoorTimer())
+	}
+	e.behaviour = EB_Idle
+	return e, cmds
+}
+
+// parking_fixed is true while the park floor is set by a mode (maintenance, recall) rather
+// than for a single trip home.
+func parking_fixed(e Elevator) bool {
+	return e.maintenance || e.recall
+}
+
+func parking_direction(e Elevator) common.MotorDirection {
+	if e.parkFloor > e.floor {
+		return common.MD_Up
+	}
+	return common.MD_Down
+}
+
+// onPark sends an idle car to its home floor, or withdraws the home floor with -1.
+// Ignored in maintenance and recall, where the car parks at the floor of the mode instead.
+func onPark(e Elevator, floor int) (Elevator, []Command) {
+	if parking_fixed(e) || floor >= common.N_FLOORS {
+		return e, nil
+	}
+	e.parkFloor = floor
+	return parking_start(e, nil)
+}
+
+// In maintenance the car takes no hall requests (see FsmSync), finishes its cab requests
+// and then parks at the maintenance floor with the door open, if one is configured.
+func onMaintenance(e Elevator, on bool) (Elevator, []Command) {
+	if e.maintenance == on {
+		return e, nil
+	}
+	e.maintenance = on
+	var cmds []Command
+	if e.recall {
+		// recall takes precedence; the mode applies once it ends
+		return e, nil
+	}
+	if on {
+		e.parkFloor = e.config.maintenanceFloor
+		e.parkDoorOpen = true
+		return parking_start(e, cmds)
+	}
+
+	e.parkFloor = -1
+	e.parkDoorOpen = false
+	if e.parked {
+		e.parked = false
+		cmds = append(cmds, StartDoorTimer())
+	}
+	return e, cmds
+}
+
+// InMaintenance reports whether the elevator is out of service for hall requests.
+func InMaintenance(e *Elevator) bool {
+	return e.maintenance
+}
+
+// ParkingPolicy sends the car to its home floor once it has been idle for idleDelay.
+// The home floor comes from the assigner, which spreads idle cars over the home floors.
+type ParkingPolicy struct {
+	idleDelay time.Duration
+	homeFloor int
+	idleSince time.Time
+	sent      bool
+}
+
+func NewParkingPolicy(idleDelay time.Duration) *ParkingPolicy {
+	return &ParkingPolicy{idleDelay: idleDelay, homeFloor: -1}
+}
+
+// SetHomeFloor updates the home floor. A car already on its way is redirected (or stopped
+// at the next floor if it no longer has a home floor).
+func (p *ParkingPolicy) SetHomeFloor(e *Elevator, floor int) {
+	if floor == p.homeFloor {
+		return
+	}
+	p.homeFloor = floor
+	p.sent = false
+	if e.parking && !parking_fixed(*e) {
+		Fsm_onPark(e, floor)
+	}
+}
+
+// Observe advances the policy for one poll. Returns true when the car was sent home now.
+func (p *ParkingPolicy) Observe(e *Elevator, now time.Time) bool {
+	if e.behaviour != EB_Idle || requests_any(*e) || parking_fixed(*e) {
+		p.idleSince = time.Time{}
+		p.sent = false
+		return false
+	}
+	if p.idleSince.IsZero() {
+		p.idleSince = now
+	}
+	if p.sent || p.homeFloor < 0 || e.floor == p.homeFloor || now.Sub(p.idleSince) < p.idleDelay {
+		return false
+	}
+	p.sent = true
+	Fsm_onPark(e, p.homeFloor)
+	return e.parking
+}
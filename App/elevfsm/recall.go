@@ -0,0 +1,58 @@
+package elevfsm
+
+import (
+	"elevator/common"
+)
+
+// Fire-service recall: every request is cancelled and new ones are ignored. The car goes
+// straight to the recall floor without stopping on the way, opens the door and stays.
+// A car with its door open closes it first; a moving car turns at the next floor if needed.
+func onRecall(e Elevator, on bool) (Elevator, []Command) {
+	if e.recall == on {
+		return e, nil
+	}
+	e.recall = on
+	var cmds []Command
+
+	if !on {
+		e.parkFloor = -1
+		e.parkDoorOpen = false
+		if e.maintenance {
+			e.parkFloor = e.config.maintenanceFloor
+			e.parkDoorOpen = true
+		}
+		if e.parked {
+			// run a door cycle; the car parks again if maintenance wants it to
+			e.parked = false
+			cmds = append(cmds, StartDoorTimer())
+		}
+		return e, cmds
+	}
+
+	e.requests = [common.N_FLOORS][common.N_BUTTONS]bool{}
+	e.served = ServicedAt{}
+	e.parkFloor = e.config.recallFloor
+	e.parkDoorOpen = true
+
+	switch e.behaviour {
+	case EB_Moving:
+		e.parking = true
+	case EB_EmergencyStop:
+		// carry on to the recall floor when released between floors
+		e.parking = !e.atFloorWhenStopped
+	case EB_DoorOpen:
+		if e.parked && e.floor != e.parkFloor {
+			e.parked = false
+			cmds = append(cmds, StartDoorTimer())
+		}
+		// otherwise the running door cycle ends in parking_start
+	case EB_Idle:
+		return parking_start(e, cmds)
+	}
+	return e, cmds
+}
+
+// InRecall reports whether the car is in fire-service recall.
+func InRecall(e *Elevator) bool {
+	return e.recall
+}
@@ -9,10 +9,19 @@ type DirnBehaviourPair struct {
 	behaviour ElevatorBehaviour
 }
 
+// requests_active tells whether the car acts on a request. A full car ignores hall
+// requests: it neither travels to them nor stops for them, but keeps them until it has room.
+func requests_active(e Elevator, floor int, btn common.ButtonType) bool {
+	if e.full && btn != common.BT_Cab {
+		return false
+	}
+	return e.requests[floor][btn]
+}
+
 func requests_above(e Elevator) int {
 	for f := e.floor + 1; f < common.N_FLOORS; f++ {
 		for btn := range common.N_BUTTONS {
-			if e.requests[f][btn] {
+			if requests_active(e, f, common.ButtonType(btn)) {
 				return 1
 			}
 		}
@@ -23,7 +32,7 @@ func requests_above(e Elevator) int {
 func requests_below(e Elevator) int {
 	for f := range e.floor {
 		for btn := range common.N_BUTTONS {
-			if e.requests[f][btn] {
+			if requests_active(e, f, common.ButtonType(btn)) {
 				return 1
 			}
 		}
@@ -33,13 +42,24 @@ func requests_below(e Elevator) int {
 
 func requests_here(e Elevator) int {
 	for btn := range common.N_BUTTONS {
-		if e.requests[e.floor][btn] {
+		if requests_active(e, e.floor, common.ButtonType(btn)) {
 			return 1
 		}
 	}
 	return 0
 }
 
+func requests_any(e Elevator) bool {
+	for f := range common.N_FLOORS {
+		for btn := range common.N_BUTTONS {
+			if requests_active(e, f, common.ButtonType(btn)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func requests_chooseDirection(e Elevator) DirnBehaviourPair {
 	switch e.dirn {
 	case common.MD_Up:
@@ -84,7 +104,7 @@ func requests_chooseDirection(e Elevator) DirnBehaviourPair {
 func requests_shouldStop(e Elevator) int {
 	switch e.dirn {
 	case common.MD_Down:
-		if e.requests[e.floor][common.BT_HallDown] ||
+		if requests_active(e, e.floor, common.BT_HallDown) ||
 			e.requests[e.floor][common.BT_Cab] ||
 			requests_below(e) == 0 {
 			return 1
@@ -92,7 +112,7 @@ func requests_shouldStop(e Elevator) int {
 		return 0
 
 	case common.MD_Up:
-		if e.requests[e.floor][common.BT_HallUp] ||
+		if requests_active(e, e.floor, common.BT_HallUp) ||
 			e.requests[e.floor][common.BT_Cab] ||
 			requests_above(e) == 0 {
 			return 1
@@ -105,39 +125,3 @@ func requests_shouldStop(e Elevator) int {
 		return 1
 	}
 }
-
-func requests_shouldClearImmediately(e Elevator, btn_floor int, btn_type common.ButtonType) int {
-	if e.floor == btn_floor &&
-		((e.dirn == common.MD_Up && btn_type == common.BT_HallUp) ||
-			(e.dirn == common.MD_Down && btn_type == common.BT_HallDown) ||
-			e.dirn == common.MD_Stop ||
-			btn_type == common.BT_Cab) {
-		return 1
-	}
-	return 0
-}
-
-func requests_clearAtCurrentFloor(e Elevator) Elevator { // TODO: this code is implemented twice
-	e.requests[e.floor][common.BT_Cab] = false
-	switch e.dirn {
-	case common.MD_Up:
-		if requests_above(e) == 0 && !e.requests[e.floor][common.BT_HallUp] {
-			e.requests[e.floor][common.BT_HallDown] = false
-		}
-		e.requests[e.floor][common.BT_HallUp] = false
-
-	case common.MD_Down:
-		if requests_below(e) == 0 && !e.requests[e.floor][common.BT_HallDown] {
-			e.requests[e.floor][common.BT_HallUp] = false
-		}
-		e.requests[e.floor][common.BT_HallDown] = false
-
-	case common.MD_Stop:
-		fallthrough
-	default:
-		e.requests[e.floor][common.BT_HallUp] = false
-		e.requests[e.floor][common.BT_HallDown] = false
-	}
-
-	return e
-}
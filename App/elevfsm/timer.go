@@ -0,0 +1,26 @@
+package elevfsm
+
+import (
+	"time"
+)
+
+// DoorTimer measures the door-open period. It is started and stopped by the
+// CMD_StartDoorTimer/CMD_StopDoorTimer commands emitted by Transition.
+type DoorTimer struct {
+	duration time.Duration
+	endTime  time.Time
+	active   bool
+}
+
+func (t *DoorTimer) Start(now time.Time) {
+	t.endTime = now.Add(t.duration)
+	t.active = true
+}
+
+func (t *DoorTimer) Stop() {
+	t.active = false
+}
+
+func (t *DoorTimer) TimedOut(now time.Time) bool {
+	return t.active && now.After(t.endTime)
+}
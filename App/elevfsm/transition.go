@@ -0,0 +1,327 @@
+package elevfsm
+
+import (
+	"elevator/common"
+)
+
+// Transition is the side-effect-free core of the elevator FSM: an event and the
+// current state go in, the next state and the output commands to perform come out.
+// The Fsm_on* functions are thin adapters that apply the commands to the hardware.
+
+type EventKind int
+
+const (
+	EV_InitBetweenFloors EventKind = iota
+	EV_RequestButtonPress
+	EV_FloorArrival
+	EV_DoorTimeout
+	EV_Obstruction
+	EV_StopButtonPress
+	EV_StopButtonRelease
+	EV_Shutdown
+	EV_Maintenance
+	EV_Park
+	EV_Load
+	EV_Recall
+)
+
+type Event struct {
+	Kind    EventKind
+	Floor   int               // EV_RequestButtonPress, EV_FloorArrival, EV_Park
+	Button  common.ButtonType // EV_RequestButtonPress
+	AtFloor bool              // EV_StopButtonPress
+	On      bool              // EV_Obstruction, EV_Maintenance, EV_Recall
+	Load    int               // EV_Load, percent of capacity
+}
+
+type CommandKind int
+
+const (
+	CMD_SetMotor CommandKind = iota
+	CMD_SetDoorLamp
+	CMD_SetStopLamp
+	CMD_SetFloorIndicator
+	CMD_StartDoorTimer
+	CMD_StopDoorTimer
+)
+
+type Command struct {
+	Kind  CommandKind
+	Motor common.MotorDirection // CMD_SetMotor
+	On    bool                  // CMD_SetDoorLamp, CMD_SetStopLamp
+	Floor int                   // CMD_SetFloorIndicator
+}
+
+func SetMotor(d common.MotorDirection) Command { return Command{Kind: CMD_SetMotor, Motor: d} }
+
+func SetDoorLamp(on bool) Command { return Command{Kind: CMD_SetDoorLamp, On: on} }
+
+func SetStopLamp(on bool) Command { return Command{Kind: CMD_SetStopLamp, On: on} }
+
+func SetFloorIndicator(floor int) Command {
+	return Command{Kind: CMD_SetFloorIndicator, Floor: floor}
+}
+
+func StartDoorTimer() Command { return Command{Kind: CMD_StartDoorTimer} }
+
+func StopDoorTimer() Command { return Command{Kind: CMD_StopDoorTimer} }
+
+// NewElevator returns an elevator in the uninitialized state (unknown floor, idle),
+// configured from cfg (request clearing policy, maintenance and recall floors, full load).
+func NewElevator(cfg common.Config) Elevator {
+	e := elevator_uninitialized()
+	e.config.clearRequestVariant = ClearRequestVariantFromString(cfg.ClearRequestType)
+	e.config.maintenanceFloor = cfg.MaintenanceFloor
+	e.config.fullLoad = cfg.FullLoadPercent
+	e.config.recallFloor = cfg.RecallFloor
+	if e.config.recallFloor < 0 || e.config.recallFloor >= common.N_FLOORS {
+		e.config.recallFloor = 0
+	}
+	if e.config.maintenanceFloor >= common.N_FLOORS {
+		e.config.maintenanceFloor = -1
+	}
+	return e
+}
+
+// Transition computes the next state and output commands for an event.
+// The input elevator is not modified.
+func Transition(e Elevator, ev Event) (Elevator, []Command) {
+	switch ev.Kind {
+	case EV_InitBetweenFloors:
+		return onInitBetweenFloors(e)
+	case EV_RequestButtonPress:
+		return onRequestButtonPress(e, ev.Floor, ev.Button)
+	case EV_FloorArrival:
+		return onFloorArrival(e, ev.Floor)
+	case EV_DoorTimeout:
+		return onDoorTimeout(e)
+	case EV_Obstruction:
+		return onObstruction(e, ev.On)
+	case EV_StopButtonPress:
+		return onStopButtonPress(e, ev.AtFloor)
+	case EV_StopButtonRelease:
+		return onStopButtonRelease(e)
+	case EV_Shutdown:
+		return onShutdown(e)
+	case EV_Maintenance:
+		return onMaintenance(e, ev.On)
+	case EV_Park:
+		return onPark(e, ev.Floor)
+	case EV_Load:
+		return onLoad(e, ev.Load)
+	case EV_Recall:
+		return onRecall(e, ev.On)
+	default:
+		return e, nil
+	}
+}
+
+func onInitBetweenFloors(e Elevator) (Elevator, []Command) {
+	e.dirn = common.MD_Down
+	e.behaviour = EB_Moving
+	return e, []Command{SetMotor(common.MD_Down)}
+}
+
+func onRequestButtonPress(e Elevator, btn_floor int, btn_type common.ButtonType) (Elevator, []Command) {
+	var cmds []Command
+	if e.recall {
+		return e, nil
+	}
+
+	switch e.behaviour {
+	case EB_DoorOpen:
+		if requests_shouldClearImmediately(e, btn_floor, btn_type) != 0 {
+			// served right away: hold the door open for a full period again
+			e = requests_markServed(e, btn_type)
+			if !e.parked {
+				cmds = append(cmds, StartDoorTimer())
+			}
+		} else {
+			e.requests[btn_floor][btn_type] = true
+			if e.parked {
+				// leave the parking spot: close the door after a normal door period
+				e.parked = false
+				cmds = append(cmds, StartDoorTimer())
+			}
+		}
+
+	case EB_Moving, EB_EmergencyStop:
+		e.requests[btn_floor][btn_type] = true
+		if e.behaviour == EB_Moving && e.parking {
+			e, cmds = parking_interrupt(e, cmds)
+		}
+
+	case EB_Idle:
+		e.requests[btn_floor][btn_type] = true
+		pair := requests_chooseDirection(e)
+		e.dirn = pair.dirn
+		e.behaviour = pair.behaviour
+
+		switch pair.behaviour {
+		case EB_DoorOpen:
+			cmds = append(cmds, SetDoorLamp(true), StartDoorTimer())
+			e = requests_clearAtCurrentFloor(e)
+
+		case EB_Moving:
+			cmds = append(cmds, SetMotor(e.dirn))
+
+		case EB_Idle:
+			// do nothing
+		}
+	}
+	return e, cmds
+}
+
+func onFloorArrival(e Elevator, newFloor int) (Elevator, []Command) {
+	if e.floor != newFloor {
+		e.served = ServicedAt{}
+	}
+	e.floor = newFloor
+	e.motorFailure = false
+	cmds := []Command{SetFloorIndicator(newFloor)}
+
+	switch e.behaviour {
+	case EB_Moving:
+		if e.parking {
+			return parking_continue(e, cmds)
+		}
+		if requests_shouldStop(e) != 0 {
+			cmds = append(cmds, SetMotor(common.MD_Stop), SetDoorLamp(true), StartDoorTimer())
+			e = requests_clearAtCurrentFloor(e)
+			e.behaviour = EB_DoorOpen
+		}
+	default:
+		// do nothing
+	}
+	return e, cmds
+}
+
+func onDoorTimeout(e Elevator) (Elevator, []Command) {
+	var cmds []Command
+
+	switch e.behaviour {
+	case EB_DoorOpen:
+		if e.obstructed {
+			// keep the door open until the obstruction is removed
+			return e, []Command{StartDoorTimer()}
+		}
+		pair := requests_chooseDirection(e)
+		e.dirn = pair.dirn
+		e.behaviour = pair.behaviour
+
+		switch e.behaviour {
+		case EB_DoorOpen:
+			cmds = append(cmds, StartDoorTimer())
+			e = requests_clearAtCurrentFloor(e)
+
+		case EB_Moving, EB_Idle:
+			cmds = append(cmds, SetDoorLamp(false), SetMotor(e.dirn))
+			if e.behaviour == EB_Idle {
+				e, cmds = parking_start(e, cmds)
+			}
+		}
+	default:
+		// do nothing
+	}
+	return e, cmds
+}
+
+// The door is held open while obstructed and stays open a full period after the
+// obstruction is removed. Obstruction has no effect while the door is closed.
+func onObstruction(e Elevator, obstructed bool) (Elevator, []Command) {
+	e.obstructed = obstructed
+	if e.behaviour != EB_DoorOpen || e.parked {
+		return e, nil
+	}
+	if obstructed {
+		return e, []Command{StopDoorTimer()}
+	}
+	return e, []Command{StartDoorTimer()}
+}
+
+// Stop is ignored until the elevator has reached a defined floor after init.
+func onStopButtonPress(e Elevator, atFloor bool) (Elevator, []Command) {
+	if e.floor == -1 || e.behaviour == EB_EmergencyStop {
+		return e, nil
+	}
+	e.behaviour = EB_EmergencyStop
+	e.atFloorWhenStopped = atFloor
+	e.parked = false
+	return e, []Command{SetMotor(common.MD_Stop), StopDoorTimer(), SetStopLamp(true), SetDoorLamp(atFloor)}
+}
+
+// Remaining requests (typically cab calls, as hall calls are reassigned while
+// stopped) are served as usual after release.
+func onStopButtonRelease(e Elevator) (Elevator, []Command) {
+	if e.behaviour != EB_EmergencyStop {
+		return e, nil
+	}
+	cmds := []Command{SetStopLamp(false)}
+
+	if e.atFloorWhenStopped {
+		// Door is already open; let the door cycle run before moving on.
+		e.parking = false
+		e.behaviour = EB_DoorOpen
+		e = requests_clearAtCurrentFloor(e)
+		return e, append(cmds, StartDoorTimer())
+	}
+
+	if e.parking && !requests_any(e) {
+		// stopped on the way to the park floor: carry on
+		e.behaviour = EB_Moving
+		return e, append(cmds, SetMotor(e.dirn))
+	}
+
+	pair := requests_chooseDirection(e)
+	switch pair.behaviour {
+	case EB_DoorOpen:
+		// Only request is at the floor we just left; head back to it.
+		pair = DirnBehaviourPair{-e.dirn, EB_Moving}
+		if e.dirn == common.MD_Stop {
+			pair.dirn = common.MD_Down
+		}
+	case EB_Idle:
+		// Nothing to do, but the car must not idle between floors: e.floor is the floor
+		// it left, not where it is. Drive on to the next floor and stop there.
+		pair = DirnBehaviourPair{e.dirn, EB_Moving}
+		if e.dirn == common.MD_Stop {
+			pair.dirn = common.MD_Down
+		}
+	}
+	e.dirn = pair.dirn
+	e.behaviour = pair.behaviour
+	return e, append(cmds, SetMotor(e.dirn))
+}
+
+// A full car passes hall requests by and only serves cab requests. Once it has room
+// again, an idle car picks up the hall requests it kept.
+func onLoad(e Elevator, load int) (Elevator, []Command) {
+	e.load = load
+	wasFull := e.full
+	e.full = e.config.fullLoad > 0 && load >= e.config.fullLoad
+	if !wasFull || e.full || e.behaviour != EB_Idle || e.floor < 0 {
+		return e, nil
+	}
+
+	var cmds []Command
+	pair := requests_chooseDirection(e)
+	e.dirn = pair.dirn
+	e.behaviour = pair.behaviour
+	switch pair.behaviour {
+	case EB_DoorOpen:
+		cmds = append(cmds, SetDoorLamp(true), StartDoorTimer())
+		e = requests_clearAtCurrentFloor(e)
+	case EB_Moving:
+		cmds = append(cmds, SetMotor(e.dirn))
+	}
+	return e, cmds
+}
+
+// The car is parked where it is with the door closed; requests are kept for persisting.
+func onShutdown(e Elevator) (Elevator, []Command) {
+	e.dirn = common.MD_Stop
+	e.behaviour = EB_Idle
+	e.parking = false
+	e.parked = false
+	return e, []Command{SetMotor(common.MD_Stop), StopDoorTimer(), SetDoorLamp(false)}
+}
@@ -0,0 +1,624 @@
+package elevfsm
+
+import (
+	"elevator/common"
+	"reflect"
+	"testing"
+)
+
+// testElevator is an initialized car idle at floor, clearing all requests at a stop.
+func testElevator(floor int) Elevator {
+	e := NewElevator(common.Config{ClearRequestType: "all", FullLoadPercent: 80, MaintenanceFloor: 0, RecallFloor: 0})
+	e.floor = floor
+	return e
+}
+
+func withRequests(e Elevator, reqs ...[2]int) Elevator {
+	for _, r := range reqs {
+		e.requests[r[0]][r[1]] = true
+	}
+	return e
+}
+
+func moving(e Elevator, dirn common.MotorDirection) Elevator {
+	e.behaviour = EB_Moving
+	e.dirn = dirn
+	return e
+}
+
+func doorOpen(e Elevator) Elevator {
+	e.behaviour = EB_DoorOpen
+	return e
+}
+
+type transitionCase struct {
+	name  string
+	in    Elevator
+	ev    Event
+	check func(t *testing.T, e Elevator)
+	cmds  []Command
+}
+
+func runTransitionCases(t *testing.T, cases []transitionCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := tc.in
+			got, cmds := Transition(tc.in, tc.ev)
+			if !reflect.DeepEqual(in, tc.in) {
+				t.Fatalf("Transition modified its input")
+			}
+			if !reflect.DeepEqual(cmds, tc.cmds) {
+				t.Errorf("commands = %+v, want %+v", cmds, tc.cmds)
+			}
+			if tc.check != nil {
+				tc.check(t, got)
+			}
+		})
+	}
+}
+
+func wantState(behaviour ElevatorBehaviour, dirn common.MotorDirection, floor int) func(*testing.T, Elevator) {
+	return func(t *testing.T, e Elevator) {
+		t.Helper()
+		if e.behaviour != behaviour || e.dirn != dirn || e.floor != floor {
+			t.Errorf("state = (behaviour %d, dirn %d, floor %d), want (%d, %d, %d)",
+				e.behaviour, e.dirn, e.floor, behaviour, dirn, floor)
+		}
+	}
+}
+
+func TestTransitionInitBetweenFloors(t *testing.T) {
+	runTransitionCases(t, []transitionCase{
+		{
+			name:  "drives down to find a floor",
+			in:    testElevator(-1),
+			ev:    Event{Kind: EV_InitBetweenFloors},
+			cmds:  []Command{SetMotor(common.MD_Down)},
+			check: wantState(EB_Moving, common.MD_Down, -1),
+		},
+	})
+}
+
+func TestTransitionRequestButtonPress(t *testing.T) {
+	runTransitionCases(t, []transitionCase{
+		{
+			name: "idle car opens the door for a request at its floor",
+			in:   testElevator(1),
+			ev:   Event{Kind: EV_RequestButtonPress, Floor: 1, Button: common.BT_HallUp},
+			cmds: []Command{SetDoorLamp(true), StartDoorTimer()},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_DoorOpen, common.MD_Stop, 1)(t, e)
+				if e.requests[1][common.BT_HallUp] {
+					t.Errorf("request at the floor not cleared")
+				}
+			},
+		},
+		{
+			name:  "idle car sets off for a request above",
+			in:    testElevator(1),
+			ev:    Event{Kind: EV_RequestButtonPress, Floor: 3, Button: common.BT_Cab},
+			cmds:  []Command{SetMotor(common.MD_Up)},
+			check: wantState(EB_Moving, common.MD_Up, 1),
+		},
+		{
+			name: "moving car stores the request",
+			in:   moving(testElevator(1), common.MD_Up),
+			ev:   Event{Kind: EV_RequestButtonPress, Floor: 0, Button: common.BT_HallUp},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_Moving, common.MD_Up, 1)(t, e)
+				if !e.requests[0][common.BT_HallUp] {
+					t.Errorf("request not stored")
+				}
+			},
+		},
+		{
+			name: "stopped car stores the request",
+			in: func() Elevator {
+				e := testElevator(1)
+				e.behaviour = EB_EmergencyStop
+				return e
+			}(),
+			ev: Event{Kind: EV_RequestButtonPress, Floor: 2, Button: common.BT_Cab},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_EmergencyStop, common.MD_Stop, 1)(t, e)
+				if !e.requests[2][common.BT_Cab] {
+					t.Errorf("request not stored")
+				}
+			},
+		},
+	})
+}
+
+func TestTransitionFloorArrival(t *testing.T) {
+	runTransitionCases(t, []transitionCase{
+		{
+			name: "stops for a cab request",
+			in:   withRequests(moving(testElevator(1), common.MD_Up), [2]int{2, int(common.BT_Cab)}),
+			ev:   Event{Kind: EV_FloorArrival, Floor: 2},
+			cmds: []Command{SetFloorIndicator(2), SetMotor(common.MD_Stop), SetDoorLamp(true), StartDoorTimer()},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_DoorOpen, common.MD_Up, 2)(t, e)
+				if e.requests[2][common.BT_Cab] {
+					t.Errorf("cab request at the floor not cleared")
+				}
+			},
+		},
+		{
+			name:  "passes a floor with no request",
+			in:    withRequests(moving(testElevator(0), common.MD_Up), [2]int{3, int(common.BT_Cab)}),
+			ev:    Event{Kind: EV_FloorArrival, Floor: 1},
+			cmds:  []Command{SetFloorIndicator(1)},
+			check: wantState(EB_Moving, common.MD_Up, 1),
+		},
+		{
+			name: "arrives at the park floor",
+			in: func() Elevator {
+				e := moving(testElevator(1), common.MD_Up)
+				e.parkFloor, e.parking = 2, true
+				return e
+			}(),
+			ev:   Event{Kind: EV_FloorArrival, Floor: 2},
+			cmds: []Command{SetFloorIndicator(2), SetMotor(common.MD_Stop)},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_Idle, common.MD_Stop, 2)(t, e)
+				if e.parking || e.parkFloor != -1 {
+					t.Errorf("still parking: parking %v, parkFloor %d", e.parking, e.parkFloor)
+				}
+			},
+		},
+		{
+			name:  "only updates the indicator when not moving",
+			in:    testElevator(-1),
+			ev:    Event{Kind: EV_FloorArrival, Floor: 0},
+			cmds:  []Command{SetFloorIndicator(0)},
+			check: wantState(EB_Idle, common.MD_Stop, 0),
+		},
+	})
+}
+
+func TestTransitionDoorTimeout(t *testing.T) {
+	runTransitionCases(t, []transitionCase{
+		{
+			name:  "closes and idles with nothing to do",
+			in:    doorOpen(testElevator(1)),
+			ev:    Event{Kind: EV_DoorTimeout},
+			cmds:  []Command{SetDoorLamp(false), SetMotor(common.MD_Stop)},
+			check: wantState(EB_Idle, common.MD_Stop, 1),
+		},
+		{
+			name:  "closes and leaves for a request above",
+			in:    withRequests(doorOpen(testElevator(1)), [2]int{3, int(common.BT_HallDown)}),
+			ev:    Event{Kind: EV_DoorTimeout},
+			cmds:  []Command{SetDoorLamp(false), SetMotor(common.MD_Up)},
+			check: wantState(EB_Moving, common.MD_Up, 1),
+		},
+		{
+			name: "stays open while obstructed",
+			in: func() Elevator {
+				e := doorOpen(testElevator(1))
+				e.obstructed = true
+				return e
+			}(),
+			ev:    Event{Kind: EV_DoorTimeout},
+			cmds:  []Command{StartDoorTimer()},
+			check: wantState(EB_DoorOpen, common.MD_Stop, 1),
+		},
+		{
+			name: "sets off to the park floor",
+			in: func() Elevator {
+				e := doorOpen(testElevator(1))
+				e.parkFloor = 3
+				return e
+			}(),
+			ev:   Event{Kind: EV_DoorTimeout},
+			cmds: []Command{SetDoorLamp(false), SetMotor(common.MD_Stop), SetMotor(common.MD_Up)},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_Moving, common.MD_Up, 1)(t, e)
+				if !e.parking {
+					t.Errorf("not parking")
+				}
+			},
+		},
+		{
+			name:  "ignored when the door is closed",
+			in:    testElevator(1),
+			ev:    Event{Kind: EV_DoorTimeout},
+			check: wantState(EB_Idle, common.MD_Stop, 1),
+		},
+	})
+}
+
+func TestTransitionObstruction(t *testing.T) {
+	runTransitionCases(t, []transitionCase{
+		{
+			name: "stops the door timer",
+			in:   doorOpen(testElevator(1)),
+			ev:   Event{Kind: EV_Obstruction, On: true},
+			cmds: []Command{StopDoorTimer()},
+			check: func(t *testing.T, e Elevator) {
+				if !e.obstructed {
+					t.Errorf("not obstructed")
+				}
+			},
+		},
+		{
+			name: "restarts the door timer when removed",
+			in: func() Elevator {
+				e := doorOpen(testElevator(1))
+				e.obstructed = true
+				return e
+			}(),
+			ev:   Event{Kind: EV_Obstruction, On: false},
+			cmds: []Command{StartDoorTimer()},
+		},
+		{
+			name: "no effect with the door closed",
+			in:   moving(testElevator(1), common.MD_Up),
+			ev:   Event{Kind: EV_Obstruction, On: true},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_Moving, common.MD_Up, 1)(t, e)
+				if !e.obstructed {
+					t.Errorf("obstruction not recorded")
+				}
+			},
+		},
+		{
+			name: "ignored while parked",
+			in: func() Elevator {
+				e := doorOpen(testElevator(0))
+				e.parked = true
+				return e
+			}(),
+			ev: Event{Kind: EV_Obstruction, On: true},
+		},
+	})
+}
+
+func TestTransitionStopButton(t *testing.T) {
+	runTransitionCases(t, []transitionCase{
+		{
+			name: "press between floors",
+			in:   moving(testElevator(1), common.MD_Up),
+			ev:   Event{Kind: EV_StopButtonPress, AtFloor: false},
+			cmds: []Command{SetMotor(common.MD_Stop), StopDoorTimer(), SetStopLamp(true), SetDoorLamp(false)},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_EmergencyStop, common.MD_Up, 1)(t, e)
+				if e.atFloorWhenStopped {
+					t.Errorf("atFloorWhenStopped set between floors")
+				}
+			},
+		},
+		{
+			name:  "press at a floor opens the door",
+			in:    testElevator(2),
+			ev:    Event{Kind: EV_StopButtonPress, AtFloor: true},
+			cmds:  []Command{SetMotor(common.MD_Stop), StopDoorTimer(), SetStopLamp(true), SetDoorLamp(true)},
+			check: wantState(EB_EmergencyStop, common.MD_Stop, 2),
+		},
+		{
+			name:  "press ignored before init",
+			in:    testElevator(-1),
+			ev:    Event{Kind: EV_StopButtonPress},
+			check: wantState(EB_Idle, common.MD_Stop, -1),
+		},
+		{
+			name: "release at a floor runs a door cycle",
+			in: func() Elevator {
+				e := testElevator(2)
+				e.behaviour, e.atFloorWhenStopped = EB_EmergencyStop, true
+				return e
+			}(),
+			ev:    Event{Kind: EV_StopButtonRelease},
+			cmds:  []Command{SetStopLamp(false), StartDoorTimer()},
+			check: wantState(EB_DoorOpen, common.MD_Stop, 2),
+		},
+		{
+			name: "release between floors heads for the remaining request",
+			in: func() Elevator {
+				e := withRequests(testElevator(1), [2]int{3, int(common.BT_Cab)})
+				e.behaviour, e.dirn = EB_EmergencyStop, common.MD_Down
+				return e
+			}(),
+			ev:    Event{Kind: EV_StopButtonRelease},
+			cmds:  []Command{SetStopLamp(false), SetMotor(common.MD_Up)},
+			check: wantState(EB_Moving, common.MD_Up, 1),
+		},
+		{
+			name: "release between floors returns to a request at the floor just left",
+			in: func() Elevator {
+				e := withRequests(testElevator(1), [2]int{1, int(common.BT_Cab)})
+				e.behaviour, e.dirn = EB_EmergencyStop, common.MD_Up
+				return e
+			}(),
+			ev:    Event{Kind: EV_StopButtonRelease},
+			cmds:  []Command{SetStopLamp(false), SetMotor(common.MD_Down)},
+			check: wantState(EB_Moving, common.MD_Down, 1),
+		},
+		{
+			name: "release between floors with no requests drives on to the next floor",
+			in: func() Elevator {
+				e := testElevator(1)
+				e.behaviour, e.dirn = EB_EmergencyStop, common.MD_Up
+				return e
+			}(),
+			ev:    Event{Kind: EV_StopButtonRelease},
+			cmds:  []Command{SetStopLamp(false), SetMotor(common.MD_Up)},
+			check: wantState(EB_Moving, common.MD_Up, 1),
+		},
+		{
+			name: "release between floors with no requests and no direction drives down",
+			in: func() Elevator {
+				e := testElevator(1)
+				e.behaviour = EB_EmergencyStop
+				return e
+			}(),
+			ev:    Event{Kind: EV_StopButtonRelease},
+			cmds:  []Command{SetStopLamp(false), SetMotor(common.MD_Down)},
+			check: wantState(EB_Moving, common.MD_Down, 1),
+		},
+		{
+			name:  "release ignored when not stopped",
+			in:    testElevator(1),
+			ev:    Event{Kind: EV_StopButtonRelease},
+			check: wantState(EB_Idle, common.MD_Stop, 1),
+		},
+	})
+}
+
+// A press at the floor the car left must not open the door between floors after a
+// release with nothing to do.
+func TestTransitionStopReleaseThenPressAtLastFloor(t *testing.T) {
+	e := testElevator(1)
+	e.behaviour, e.dirn = EB_EmergencyStop, common.MD_Up
+
+	e, _ = Transition(e, Event{Kind: EV_StopButtonRelease})
+	e, cmds := Transition(e, Event{Kind: EV_RequestButtonPress, Floor: 1, Button: common.BT_Cab})
+	if len(cmds) != 0 {
+		t.Errorf("commands = %+v, want none", cmds)
+	}
+	wantState(EB_Moving, common.MD_Up, 1)(t, e)
+	if !e.requests[1][common.BT_Cab] {
+		t.Errorf("request at the floor left cleared without being served")
+	}
+
+	e, cmds = Transition(e, Event{Kind: EV_FloorArrival, Floor: 2})
+	want := []Command{SetFloorIndicator(2), SetMotor(common.MD_Stop), SetDoorLamp(true), StartDoorTimer()}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Errorf("at the next floor: commands = %+v, want %+v", cmds, want)
+	}
+	wantState(EB_DoorOpen, common.MD_Up, 2)(t, e)
+}
+
+func TestTransitionPark(t *testing.T) {
+	runTransitionCases(t, []transitionCase{
+		{
+			name: "idle car sets off",
+			in:   testElevator(0),
+			ev:   Event{Kind: EV_Park, Floor: 2},
+			cmds: []Command{SetMotor(common.MD_Up)},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_Moving, common.MD_Up, 0)(t, e)
+				if !e.parking || e.parkFloor != 2 {
+					t.Errorf("parking %v to %d, want to 2", e.parking, e.parkFloor)
+				}
+			},
+		},
+		{
+			name:  "car with requests stays on them",
+			in:    withRequests(moving(testElevator(0), common.MD_Up), [2]int{3, int(common.BT_Cab)}),
+			ev:    Event{Kind: EV_Park, Floor: 2},
+			check: wantState(EB_Moving, common.MD_Up, 0),
+		},
+		{
+			name: "full car with only hall requests sets off",
+			in: func() Elevator {
+				e := withRequests(testElevator(0), [2]int{3, int(common.BT_HallDown)})
+				e.load, e.full = 90, true
+				return e
+			}(),
+			ev:   Event{Kind: EV_Park, Floor: 2},
+			cmds: []Command{SetMotor(common.MD_Up)},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_Moving, common.MD_Up, 0)(t, e)
+				if !e.parking || e.parkFloor != 2 {
+					t.Errorf("parking %v to %d, want to 2", e.parking, e.parkFloor)
+				}
+			},
+		},
+		{
+			name: "ignored in maintenance",
+			in: func() Elevator {
+				e := testElevator(1)
+				e.maintenance = true
+				return e
+			}(),
+			ev:    Event{Kind: EV_Park, Floor: 3},
+			check: wantState(EB_Idle, common.MD_Stop, 1),
+		},
+	})
+}
+
+func TestTransitionRequestWhileParking(t *testing.T) {
+	parkingUp := func() Elevator {
+		e := moving(testElevator(1), common.MD_Up)
+		e.parkFloor, e.parking = 3, true
+		return e
+	}
+	stoppedParking := func(dirn common.MotorDirection) func(*testing.T, Elevator) {
+		return func(t *testing.T, e Elevator) {
+			wantState(EB_Moving, dirn, 1)(t, e)
+			if e.parking || e.parkFloor != -1 {
+				t.Errorf("still parking: parking %v, parkFloor %d", e.parking, e.parkFloor)
+			}
+		}
+	}
+	runTransitionCases(t, []transitionCase{
+		{
+			name:  "request ahead: carries on to it",
+			in:    parkingUp(),
+			ev:    Event{Kind: EV_RequestButtonPress, Floor: 2, Button: common.BT_Cab},
+			check: stoppedParking(common.MD_Up),
+		},
+		{
+			name:  "request behind: turns at once",
+			in:    parkingUp(),
+			ev:    Event{Kind: EV_RequestButtonPress, Floor: 0, Button: common.BT_HallUp},
+			cmds:  []Command{SetMotor(common.MD_Down)},
+			check: stoppedParking(common.MD_Down),
+		},
+		{
+			name:  "request at the floor just left: goes back",
+			in:    parkingUp(),
+			ev:    Event{Kind: EV_RequestButtonPress, Floor: 1, Button: common.BT_Cab},
+			cmds:  []Command{SetMotor(common.MD_Down)},
+			check: stoppedParking(common.MD_Down),
+		},
+	})
+}
+
+func TestTransitionLoad(t *testing.T) {
+	full := func(e Elevator) Elevator {
+		e.load, e.full = 90, true
+		return e
+	}
+	runTransitionCases(t, []transitionCase{
+		{
+			name: "full car stops taking hall requests",
+			in:   testElevator(0),
+			ev:   Event{Kind: EV_Load, Load: 85},
+			check: func(t *testing.T, e Elevator) {
+				if !e.full || e.load != 85 {
+					t.Errorf("full %v load %d, want full at 85", e.full, e.load)
+				}
+			},
+		},
+		{
+			name: "idle car with room again picks up the hall request it kept",
+			in:   full(withRequests(testElevator(0), [2]int{2, int(common.BT_HallUp)})),
+			ev:   Event{Kind: EV_Load, Load: 40},
+			cmds: []Command{SetMotor(common.MD_Up)},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_Moving, common.MD_Up, 0)(t, e)
+				if e.full {
+					t.Errorf("still full")
+				}
+			},
+		},
+		{
+			name:  "moving car with room again carries on",
+			in:    full(withRequests(moving(testElevator(0), common.MD_Up), [2]int{2, int(common.BT_HallUp)})),
+			ev:    Event{Kind: EV_Load, Load: 40},
+			check: wantState(EB_Moving, common.MD_Up, 0),
+		},
+	})
+}
+
+func TestTransitionRecall(t *testing.T) {
+	runTransitionCases(t, []transitionCase{
+		{
+			name: "idle car cancels its requests and goes to the recall floor",
+			in:   withRequests(testElevator(2), [2]int{3, int(common.BT_Cab)}),
+			ev:   Event{Kind: EV_Recall, On: true},
+			cmds: []Command{SetMotor(common.MD_Down)},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_Moving, common.MD_Down, 2)(t, e)
+				if e.requests[3][common.BT_Cab] {
+					t.Errorf("request not cancelled")
+				}
+				if !e.recall || !e.parking || e.parkFloor != 0 {
+					t.Errorf("recall %v parking %v to %d, want to 0", e.recall, e.parking, e.parkFloor)
+				}
+			},
+		},
+		{
+			name: "car at the recall floor parks with the door open",
+			in:   testElevator(0),
+			ev:   Event{Kind: EV_Recall, On: true},
+			cmds: []Command{SetMotor(common.MD_Stop), SetDoorLamp(true), StopDoorTimer()},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_DoorOpen, common.MD_Stop, 0)(t, e)
+				if !e.parked {
+					t.Errorf("not parked")
+				}
+			},
+		},
+		{
+			name: "requests are ignored during recall",
+			in: func() Elevator {
+				e := testElevator(0)
+				e.recall = true
+				return e
+			}(),
+			ev: Event{Kind: EV_RequestButtonPress, Floor: 2, Button: common.BT_Cab},
+			check: func(t *testing.T, e Elevator) {
+				if e.requests[2][common.BT_Cab] {
+					t.Errorf("request taken during recall")
+				}
+			},
+		},
+		{
+			name: "end of recall releases the parked car",
+			in: func() Elevator {
+				e := doorOpen(testElevator(0))
+				e.recall, e.parked, e.parkFloor, e.parkDoorOpen = true, true, 0, true
+				return e
+			}(),
+			ev:   Event{Kind: EV_Recall, On: false},
+			cmds: []Command{StartDoorTimer()},
+			check: func(t *testing.T, e Elevator) {
+				if e.recall || e.parked || e.parkFloor != -1 {
+					t.Errorf("recall %v parked %v parkFloor %d after recall ended", e.recall, e.parked, e.parkFloor)
+				}
+			},
+		},
+	})
+}
+
+func TestTransitionMaintenance(t *testing.T) {
+	runTransitionCases(t, []transitionCase{
+		{
+			name: "idle car goes to the maintenance floor",
+			in:   testElevator(2),
+			ev:   Event{Kind: EV_Maintenance, On: true},
+			cmds: []Command{SetMotor(common.MD_Down)},
+			check: func(t *testing.T, e Elevator) {
+				wantState(EB_Moving, common.MD_Down, 2)(t, e)
+				if !e.maintenance || !e.parking || e.parkFloor != 0 {
+					t.Errorf("maintenance %v parking %v to %d, want to 0", e.maintenance, e.parking, e.parkFloor)
+				}
+			},
+		},
+		{
+			name:  "car with cab requests finishes them first",
+			in:    withRequests(testElevator(2), [2]int{3, int(common.BT_Cab)}),
+			ev:    Event{Kind: EV_Maintenance, On: true},
+			check: wantState(EB_Idle, common.MD_Stop, 2),
+		},
+		{
+			name: "back in service releases the parked car",
+			in: func() Elevator {
+				e := doorOpen(testElevator(0))
+				e.maintenance, e.parked, e.parkFloor, e.parkDoorOpen = true, true, 0, true
+				return e
+			}(),
+			ev:   Event{Kind: EV_Maintenance, On: false},
+			cmds: []Command{StartDoorTimer()},
+			check: func(t *testing.T, e Elevator) {
+				if e.maintenance || e.parked || e.parkFloor != -1 {
+					t.Errorf("maintenance %v parked %v parkFloor %d", e.maintenance, e.parked, e.parkFloor)
+				}
+			},
+		},
+		{
+			name: "waits for the end of recall",
+			in: func() Elevator {
+				e := testElevator(2)
+				e.recall = true
+				return e
+			}(),
+			ev:    Event{Kind: EV_Maintenance, On: true},
+			check: wantState(EB_Idle, common.MD_Stop, 2),
+		},
+	})
+}
@@ -0,0 +1,91 @@
+package elevfsm
+
+import (
+	"log"
+	"time"
+)
+
+// MotorWatchdog expects a floor arrival within travelTimeout while the car is moving.
+// When the deadline passes the elevator is flagged with a motor failure, which is
+// cleared again by the next floor arrival.
+type MotorWatchdog struct {
+	travelTimeout time.Duration
+	deadline      time.Time
+	armed         bool
+}
+
+func NewMotorWatchdog(travelTimeout time.Duration) *MotorWatchdog {
+	return &MotorWatchdog{travelTimeout: travelTimeout}
+}
+
+// Observe advances the watchdog for one poll. arrived reports whether a floor arrival
+// was handled during this poll. Returns true when a motor failure was detected now.
+func (w *MotorWatchdog) Observe(e *Elevator, arrived bool, now time.Time) bool {
+	if arrived || e.behaviour != EB_Moving {
+		w.armed = false
+	}
+	if e.behaviour != EB_Moving {
+		return false
+	}
+	if !w.armed {
+		w.armed = true
+		w.deadline = now.Add(w.travelTimeout)
+		return false
+	}
+	if now.After(w.deadline) && !e.motorFailure {
+		e.motorFailure = true
+		log.Printf("fsmThread: no floor arrival within %v while moving, motor failure", w.travelTimeout)
+		return true
+	}
+	return false
+}
+
+// MotorFailure reports whether the watchdog has flagged the elevator as stuck.
+func MotorFailure(e *Elevator) bool {
+	return e.motorFailure
+}
+
+// ObstructionWatchdog flags an obstruction fault when the door has been held open by
+// the obstruction switch for longer than faultTimeout. The fault clears once the
+// obstruction is removed and the door has closed.
+type ObstructionWatchdog struct {
+	faultTimeout    time.Duration
+	obstructedSince time.Time
+}
+
+func NewObstructionWatchdog(faultTimeout time.Duration) *ObstructionWatchdog {
+	return &ObstructionWatchdog{faultTimeout: faultTimeout}
+}
+
+// Observe advances the watchdog for one poll. Returns true when the fault was raised or cleared.
+func (w *ObstructionWatchdog) Observe(e *Elevator, obstructed bool, now time.Time) bool {
+	if !obstructed || e.behaviour != EB_DoorOpen {
+		w.obstructedSince = time.Time{}
+	}
+	if e.obstructionFault {
+		if !obstructed && e.behaviour != EB_DoorOpen {
+			e.obstructionFault = false
+			log.Printf("fsmThread: obstruction removed and door closed, obstruction fault cleared")
+			return true
+		}
+		return false
+	}
+	if !obstructed || e.behaviour != EB_DoorOpen {
+		return false
+	}
+	if w.obstructedSince.IsZero() {
+		w.obstructedSince = now
+		return false
+	}
+	if now.Sub(w.obstructedSince) >= w.faultTimeout {
+		e.obstructionFault = true
+		log.Printf("fsmThread: door obstructed for %v, obstruction fault", w.faultTimeout)
+		return true
+	}
+	return false
+}
+
+// ObstructionFault reports whether the elevator is blocked by a prolonged obstruction.
+func ObstructionFault(e *Elevator) bool {
+	return e.obstructionFault
+}
@@ -0,0 +1,158 @@
+package elevnetwork
+
+import (
+	"elevator/common"
+	"fmt"
+	"time"
+)
+
+// Coherence describes how far the alive nodes agree on the shared state. The assigner only
+// runs on a coherent view (peer-to-peer mode), so while the group is incoherent hall
+// requests are not reassigned.
+type Coherence struct {
+	Coherent    bool
+	Reference   string        // node the others are compared with
+	Divergences []Divergence  // one entry per differing field
+	Since       time.Time     // start of the current incoherent period, zero when coherent
+	Incoherent  time.Duration // total time spent incoherent since start
+	Periods     int           // number of incoherent periods since start
+}
+
+// Divergence is a field where a node's last snapshot differs from the reference node's.
+type Divergence struct {
+	Peer  string
+	Field string // e.g. "hallRequests[2].up", "states[3].cabRequests[1]"
+	Want  string // reference value
+	Got   string // the peer's value
+}
+
+func (d Divergence) String() string {
+	return fmt.Sprintf("%s: %s=%s (ref %s)", d.Peer, d.Field, d.Got, d.Want)
+}
+
+// coherenceStats tracks how long the group has been incoherent.
+type coherenceStats struct {
+	since      time.Time
+	incoherent time.Duration
+	periods    int
+}
+
+// Coherence compares the last snapshot from every alive node with the reference node's,
+// on the fields covered by the coherence digest, and updates the incoherence statistics.
+func (wv *WorldView) Coherence() Coherence {
+	wv.mu.Lock()
+	defer wv.mu.Unlock()
+	now := time.Now()
+
+	c := Coherence{Coherent: wv.snapshotsAgreeLocked()}
+	if !c.Coherent {
+		alive := wv.aliveMapLocked(now)
+		for _, id := range wv.peers {
+			if !alive[id] {
+				continue
+			}
+			if c.Reference == "" {
+				c.Reference = id
+				continue
+			}
+			c.Divergences = append(c.Divergences, wv.diffLocked(c.Reference, id)...)
+		}
+	}
+
+	st := &wv.coherence
+	switch {
+	case !c.Coherent && st.since.IsZero():
+		st.since = now
+		st.periods++
+	case c.Coherent && !st.since.IsZero():
+		st.incoherent += now.Sub(st.since)
+		st.since = time.Time{}
+	}
+	c.Since = st.since
+	c.Incoherent = st.incoherent
+	if !st.since.IsZero() {
+		c.Incoherent += now.Sub(st.since)
+	}
+	c.Periods = st.periods
+	return c
+}
+
+func (wv *WorldView) diffLocked(refID string, id string) []Divergence {
+	ref, okRef := wv.lastSnap[refID]
+	snap, ok := wv.lastSnap[id]
+	switch {
+	case !okRef:
+		return []Divergence{{Peer: refID, Field: "snapshot", Want: "received", Got: "none"}}
+	case !ok:
+		return []Divergence{{Peer: id, Field: "snapshot", Want: "received", Got: "none"}}
+	}
+
+	var out []Divergence
+	add := func(field string, want, got any) {
+		w, g := fmt.Sprint(want), fmt.Sprint(got)
+		if w != g {
+			out = append(out, Divergence{Peer: id, Field: field, Want: w, Got: g})
+		}
+	}
+	hallAt := func(s common.Snapshot, f, c int) bool { return f < len(s.HallRequests) && s.HallRequests[f][c] }
+	sinceAt := func(s common.Snapshot, f, c int) int64 {
+		if f < len(s.HallSince) {
+			return s.HallSince[f][c]
+		}
+		return 0
+	}
+	overdueAt := func(s common.Snapshot, f, c int) bool { return f < len(s.HallOverdue) && s.HallOverdue[f][c] }
+	for f := 0; f < common.N_FLOORS; f++ {
+		for c, name := range [2]string{"up", "down"} {
+			add(fmt.Sprintf("hallRequests[%d].%s", f, name), hallAt(ref, f, c), hallAt(snap, f, c))
+			add(fmt.Sprintf("hallSince[%d].%s", f, name), sinceAt(ref, f, c), sinceAt(snap, f, c))
+			add(fmt.Sprintf("hallOverdue[%d].%s", f, name), overdueAt(ref, f, c), overdueAt(snap, f, c))
+		}
+	}
+	add("recall", ref.Recall, snap.Recall)
+	add("traffic", ref.Traffic.Mode, snap.Traffic.Mode)
+	for from := 0; from < common.N_FLOORS; from++ {
+		for to := 0; to < common.N_FLOORS; to++ {
+			add(fmt.Sprintf("destinationRequests[%d][%d]", from, to),
+				destinationAt(ref.DestinationRequests, from, to), destinationAt(snap.DestinationRequests, from, to))
+		}
+	}
+	add("assignment", assignmentID(ref.Assignment), assignmentID(snap.Assignment))
+
+	for _, el := range wv.peers {
+		a, okA := ref.States[el]
+		b, okB := snap.States[el]
+		if okA != okB {
+			add(fmt.Sprintf("states[%s]", el), present(okA), present(okB))
+			continue
+		}
+		if !okA {
+			continue
+		}
+		add(fmt.Sprintf("states[%s].behaviour", el), a.Behavior, b.Behavior)
+		add(fmt.Sprintf("states[%s].direction", el), a.Direction, b.Direction)
+		add(fmt.Sprintf("states[%s].floor", el), a.Floor, b.Floor)
+		for f := 0; f < common.N_FLOORS; f++ {
+			add(fmt.Sprintf("states[%s].cabRequests[%d]", el, f), cabAt(a, f), cabAt(b, f))
+		}
+	}
+	return out
+}
+
+func cabAt(st common.ElevState, f int) bool {
+	return f < len(st.CabRequests) && st.CabRequests[f]
+}
+
+func assignmentID(a *common.Assignment) string {
+	if a == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%s#%d", a.Leader, a.Seq)
+}
+
+func present(ok bool) string {
+	if ok {
+		return "present"
+	}
+	return "missing"
+}
@@ -0,0 +1,96 @@
+package elevnetwork
+
+import (
+	"time"
+)
+
+// Messages are gossiped: a node that receives a message it has not seen before passes it on
+// to its own peers, but only while some node may not have it yet. A message carries the peers
+// its origin is directly connected to (Links), so in a full mesh nobody relays, and a hop
+// limit (TTL) so a relayed message dies out after crossing the group once.
+
+// seenTimeout is how long a message ID is remembered after it was first seen.
+const seenTimeout = 2 * wvTimeout
+
+// msgID identifies a message: a node never sends the same counter twice in one epoch.
+type msgID struct {
+	origin  string
+	epoch   uint64
+	counter uint64
+}
+
+func (m netMsg) id() msgID {
+	return msgID{origin: m.Origin, epoch: m.Epoch, counter: m.Counter}
+}
+
+// seenCache remembers recently seen message IDs so a relayed copy is handled only once.
+type seenCache struct {
+	at        map[msgID]time.Time
+	lastPrune time.Time
+}
+
+func newSeenCache() seenCache {
+	return seenCache{at: make(map[msgID]time.Time)}
+}
+
+// check reports whether id was seen before and remembers it otherwise.
+func (c *seenCache) check(id msgID, now time.Time) bool {
+	if now.Sub(c.lastPrune) > seenTimeout {
+		for k, t := range c.at {
+			if now.Sub(t) > seenTimeout {
+				delete(c.at, k)
+			}
+		}
+		c.lastPrune = now
+	}
+	if _, ok := c.at[id]; ok {
+		return true
+	}
+	c.at[id] = now
+	return false
+}
+
+// hopLimit is the TTL a message starts with: the longest path between two of the nodes.
+func (wv *WorldView) hopLimit() int {
+	if len(wv.peers) < 2 {
+		return 1
+	}
+	return len(wv.peers) - 1
+}
+
+// observeHopsLocked records a message that came straight from its origin, not relayed.
+func (wv *WorldView) observeHopsLocked(msg netMsg, now time.Time) {
+	if msg.TTL == wv.hopLimit() {
+		wv.direct[msg.Origin] = now
+	}
+}
+
+// linksLocked lists the peers this node has heard from directly within the peer timeout.
+func (wv *WorldView) linksLocked(now time.Time) []string {
+	links := make([]string, 0, len(wv.peers))
+	for _, id := range wv.peers {
+		if t, ok := wv.direct[id]; ok && now.Sub(t) <= wv.peerTimeout {
+			links = append(links, id)
+		}
+	}
+	return links
+}
+
+// relayLocked returns the copy of msg to pass on, or false if it must not be relayed: it has
+// no hops left, or its origin is linked to every other node so they all have it already.
+func (wv *WorldView) relayLocked(msg netMsg) (netMsg, bool) {
+	if msg.TTL <= 1 {
+		return netMsg{}, false
+	}
+	linked := make(map[string]bool, len(msg.Links))
+	for _, id := range msg.Links {
+		linked[id] = true
+	}
+	for _, id := range wv.peers {
+		if id != msg.Origin && id != wv.selfKey && !linked[id] {
+			msg.TTL--
+			return msg, true
+		}
+	}
+	return netMsg{}, false
+}
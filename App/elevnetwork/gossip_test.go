@@ -0,0 +1,184 @@
+package elevnetwork
+
+import (
+	"elevator/common"
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+// testNet connects WorldViews through fake senders. Frames are queued and delivered by pump,
+// so the order is the one a real network would most likely give: first sent, first delivered.
+type testNet struct {
+	nodes    map[string]*WorldView
+	links    map[string][]string
+	queue    []testFrame
+	received map[[2]string]int // frames delivered, by {receiver, origin}
+	relayed  map[string]int    // frames sent on behalf of another origin, by sender
+}
+
+type testFrame struct {
+	from, to string
+	payload  []byte
+}
+
+type testSender struct {
+	net  *testNet
+	self string
+}
+
+func (s *testSender) Broadcast(b []byte) {
+	if msg, ok := decodeNetMsg(b); ok && msg.Origin != s.self {
+		s.net.relayed[s.self]++
+	}
+	for _, to := range s.net.links[s.self] {
+		s.net.queue = append(s.net.queue, testFrame{from: s.self, to: to, payload: append([]byte(nil), b...)})
+	}
+}
+
+func (s *testSender) Close(string) {}
+
+// newTestNet makes n nodes with keys "1".."n" and the given undirected links.
+func newTestNet(n int, links [][2]string) *testNet {
+	net := &testNet{
+		nodes:    make(map[string]*WorldView),
+		links:    make(map[string][]string),
+		received: make(map[[2]string]int),
+		relayed:  make(map[string]int),
+	}
+	cfg := common.Config{HostByID: make(map[int]string)}
+	for id := 1; id <= n; id++ {
+		cfg.HostByID[id] = "127.0.0.1"
+	}
+	for id := 1; id <= n; id++ {
+		cfg.SelfKey = strconv.Itoa(id)
+		net.nodes[cfg.SelfKey] = newWorldView(&testSender{net: net, self: cfg.SelfKey}, cfg)
+	}
+	for _, l := range links {
+		net.links[l[0]] = append(net.links[l[0]], l[1])
+		net.links[l[1]] = append(net.links[l[1]], l[0])
+	}
+	return net
+}
+
+func (net *testNet) pump() {
+	for len(net.queue) > 0 {
+		f := net.queue[0]
+		net.queue = net.queue[1:]
+		if msg, ok := decodeNetMsg(f.payload); ok {
+			net.received[[2]string{f.to, msg.Origin}]++
+		}
+		net.nodes[f.to].HandleRemoteFrame(f.payload)
+	}
+}
+
+// warmUp lets every node send once so they all learn their direct links, then clears the counts.
+func (net *testNet) warmUp() {
+	for round := 0; round < 2; round++ {
+		for _, wv := range net.nodes {
+			wv.Poke()
+		}
+		net.pump()
+	}
+	net.received = make(map[[2]string]int)
+	net.relayed = make(map[string]int)
+}
+
+func TestGossipLineRelaysOnce(t *testing.T) {
+	net := newTestNet(3, [][2]string{{"1", "2"}, {"2", "3"}})
+	net.warmUp()
+
+	net.nodes["1"].Poke()
+	net.pump()
+
+	if got := net.received[[2]string{"3", "1"}]; got != 1 {
+		t.Errorf("node 3 got node 1's message %d times, want 1", got)
+	}
+	if got := net.relayed["2"]; got != 1 {
+		t.Errorf("node 2 relayed %d times, want 1", got)
+	}
+	if got := net.relayed["3"]; got != 0 {
+		t.Errorf("node 3 relayed %d times, want 0", got)
+	}
+	if _, ok := net.nodes["3"].latestCount["1"]; !ok {
+		t.Errorf("node 3 did not accept node 1's message")
+	}
+}
+
+func TestGossipFullMeshDoesNotRelay(t *testing.T) {
+	net := newTestNet(3, [][2]string{{"1", "2"}, {"2", "3"}, {"1", "3"}})
+	net.warmUp()
+
+	for _, id := range []string{"1", "2", "3"} {
+		net.nodes[id].Poke()
+	}
+	net.pump()
+
+	for _, id := range []string{"1", "2", "3"} {
+		if got := net.relayed[id]; got != 0 {
+			t.Errorf("node %s relayed %d times in a full mesh, want 0", id, got)
+		}
+	}
+	if got := net.received[[2]string{"3", "1"}]; got != 1 {
+		t.Errorf("node 3 got node 1's message %d times, want 1", got)
+	}
+}
+
+func TestGossipTTLStopsRelay(t *testing.T) {
+	// 1-2-3-4: the hop limit is 3, enough to cross the line once and no further
+	net := newTestNet(4, [][2]string{{"1", "2"}, {"2", "3"}, {"3", "4"}})
+	net.warmUp()
+
+	net.nodes["1"].Poke()
+	net.pump()
+	if got := net.received[[2]string{"4", "1"}]; got != 1 {
+		t.Fatalf("node 4 got node 1's message %d times, want 1", got)
+	}
+	if got := net.relayed["4"]; got != 0 {
+		t.Errorf("node 4 relayed a message with no hops left")
+	}
+
+	// a message arriving with one hop left is applied but not passed on
+	wv := net.nodes["2"]
+	msg := netMsg{Origin: "1", Epoch: wv.latestEpoch["1"], Counter: wv.latestCount["1"] + 1, TTL: 1,
+		Snapshot: common.Snapshot{HallRequests: make([][2]bool, common.N_FLOORS)}}
+	net.relayed = make(map[string]int)
+	wv.HandleRemoteFrame(encodeTestMsg(t, msg))
+	net.pump()
+	if got := net.relayed["2"]; got != 0 {
+		t.Errorf("node 2 relayed a message with TTL 1 %d times", got)
+	}
+}
+
+func TestGossipSeenCacheDropsDuplicates(t *testing.T) {
+	net := newTestNet(3, [][2]string{{"1", "2"}, {"2", "3"}})
+	net.warmUp()
+
+	wv := net.nodes["2"]
+	msg := netMsg{Origin: "1", Epoch: wv.latestEpoch["1"], Counter: wv.latestCount["1"] + 1, TTL: wv.hopLimit(),
+		Links: []string{"2"}, Snapshot: common.Snapshot{HallRequests: make([][2]bool, common.N_FLOORS)}}
+	frame := encodeTestMsg(t, msg)
+
+	if _, _, ok := wv.HandleRemoteFrame(frame); !ok {
+		t.Fatalf("first copy was not accepted")
+	}
+	if _, _, ok := wv.HandleRemoteFrame(frame); ok {
+		t.Errorf("duplicate was accepted")
+	}
+	net.pump()
+	if got := net.relayed["2"]; got != 1 {
+		t.Errorf("node 2 relayed %d times, want 1", got)
+	}
+	if got := net.received[[2]string{"3", "1"}]; got != 1 {
+		t.Errorf("node 3 got the message %d times, want 1", got)
+	}
+}
+
+func encodeTestMsg(t *testing.T, msg netMsg) []byte {
+	t.Helper()
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
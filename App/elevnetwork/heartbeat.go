@@ -0,0 +1,160 @@
+package elevnetwork
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	quic "github.com/quic-go/quic-go"
+)
+
+// Heartbeats go as unreliable QUIC datagrams, so a congested state stream does not delay them.
+// Each ping is echoed back as a pong, which gives the round-trip time, measured on our own
+// monotonic clock from when the ping was sent; a ping without a pong within
+// heartbeatLossTimeout counts as lost.
+const (
+	heartbeatPeriod      = 250 * time.Millisecond
+	heartbeatLossTimeout = time.Second
+	rttSmoothing         = 8 // weight of the history in the smoothed RTT, as in TCP
+)
+
+type heartbeat struct {
+	Seq  uint64 `json:"seq"` // echoed back in the pong
+	Pong bool   `json:"pong,omitempty"`
+}
+
+// PeerStats describes the link to a peer, measured by heartbeats.
+type PeerStats struct {
+	RTT       time.Duration // smoothed round-trip time
+	Sent      uint64        // pings sent
+	Lost      uint64        // pings not answered in time
+	LastHeard time.Time     // last heartbeat (ping or pong) from the peer
+}
+
+// Loss is the fraction of pings lost.
+func (s PeerStats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Lost) / float64(s.Sent)
+}
+
+// linkStats is kept per peer ID, across reconnects.
+type linkStats struct {
+	mu          sync.Mutex
+	stats       PeerStats
+	seq         uint64
+	outstanding map[uint64]time.Time // pings waiting for their pong
+}
+
+func (m *Manager) linkStatsFor(id int) *linkStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ls, ok := m.links[id]
+	if !ok {
+		ls = &linkStats{outstanding: make(map[uint64]time.Time)}
+		m.links[id] = ls
+	}
+	return ls
+}
+
+// PeerStats returns the heartbeat statistics of every peer heard from so far.
+func (m *Manager) PeerStats() map[int]PeerStats {
+	m.mu.RLock()
+	links := make(map[int]*linkStats, len(m.links))
+	for id, ls := range m.links {
+		links[id] = ls
+	}
+	m.mu.RUnlock()
+	out := make(map[int]PeerStats, len(links))
+	for id, ls := range links {
+		ls.mu.Lock()
+		out[id] = ls.stats
+		ls.mu.Unlock()
+	}
+	return out
+}
+
+// startHeartbeats pings the peer and answers its pings for as long as conn lives. Peers that
+// did not enable datagrams get no heartbeats; their liveness comes from the state messages.
+func (m *Manager) startHeartbeats(id int, conn *quic.Conn) {
+	if !conn.ConnectionState().SupportsDatagrams.Remote {
+		return
+	}
+	ls := m.linkStatsFor(id)
+	ctx := conn.Context()
+
+	go func() {
+		ticker := time.NewTicker(heartbeatPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sendHeartbeat(conn, ls.ping(time.Now()))
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			b, err := conn.ReceiveDatagram(ctx)
+			if err != nil {
+				return
+			}
+			var hb heartbeat
+			if json.Unmarshal(b, &hb) != nil {
+				continue
+			}
+			ls.heard(hb, time.Now())
+			if !hb.Pong {
+				hb.Pong = true
+				sendHeartbeat(conn, hb)
+			}
+		}
+	}()
+}
+
+func sendHeartbeat(conn *quic.Conn, hb heartbeat) {
+	if b, err := json.Marshal(hb); err == nil {
+		_ = conn.SendDatagram(b)
+	}
+}
+
+// ping returns the next ping to send and counts the earlier ones that went unanswered.
+func (ls *linkStats) ping(now time.Time) heartbeat {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	for seq, sent := range ls.outstanding {
+		if now.Sub(sent) > heartbeatLossTimeout {
+			delete(ls.outstanding, seq)
+			ls.stats.Lost++
+		}
+	}
+	ls.seq++
+	ls.stats.Sent++
+	ls.outstanding[ls.seq] = now
+	return heartbeat{Seq: ls.seq}
+}
+
+// heard records a heartbeat from the peer; a pong to an outstanding ping updates the RTT.
+func (ls *linkStats) heard(hb heartbeat, now time.Time) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.stats.LastHeard = now
+	if !hb.Pong {
+		return
+	}
+	sent, ok := ls.outstanding[hb.Seq]
+	if !ok {
+		return // late, already counted as lost, or from before a restart
+	}
+	delete(ls.outstanding, hb.Seq)
+	rtt := now.Sub(sent)
+	if ls.stats.RTT == 0 {
+		ls.stats.RTT = rtt
+	} else {
+		ls.stats.RTT += (rtt - ls.stats.RTT) / rttSmoothing
+	}
+}
@@ -0,0 +1,64 @@
+package elevnetwork
+
+import (
+	"elevator/common"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	quic "github.com/quic-go/quic-go"
+)
+
+// ProtocolVersion is exchanged in the hello; peers with another version are refused.
+// Optional features such as the datagram heartbeats are negotiated by QUIC instead.
+const ProtocolVersion = 1
+
+// hello is the first frame each side writes on a new stream, before any netMsg.
+type hello struct {
+	ID      int `json:"id"`
+	Version int `json:"version"`
+}
+
+// handshake exchanges hellos on a new stream and returns the peer's elevator ID. A dialing side
+// passes the ID it dialed as want, the accepting side passes 0 to take any known peer.
+func (m *Manager) handshake(st *quic.Stream, want int) (int, error) {
+	b, err := json.Marshal(hello{ID: m.selfID, Version: ProtocolVersion})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := WriteFixedFrame(st, b, m.frameSize, helloTimeout); err != nil {
+		return 0, fmt.Errorf("write hello: %w", err)
+	}
+
+	buf := make([]byte, m.frameSize)
+	_ = st.SetReadDeadline(time.Now().Add(helloTimeout))
+	_, err = io.ReadFull(st, buf)
+	_ = st.SetReadDeadline(time.Time{})
+	if err != nil {
+		return 0, fmt.Errorf("read hello: %w", err)
+	}
+	var h hello
+	if err := json.Unmarshal(common.TrimZeros(buf), &h); err != nil {
+		return 0, fmt.Errorf("decode hello: %w", err)
+	}
+	switch {
+	case h.Version != ProtocolVersion:
+		return 0, fmt.Errorf("peer %d speaks protocol %d, want %d", h.ID, h.Version, ProtocolVersion)
+	case want != 0 && h.ID != want:
+		return 0, fmt.Errorf("dialed peer %d, got %d", want, h.ID)
+	case !m.knownPeer(h.ID):
+		return 0, fmt.Errorf("unknown peer %d", h.ID)
+	}
+	return h.ID, nil
+}
+
+// wins reports whether connection a should be kept over b to the same peer. Both sides apply
+// the same rule: the connection dialed by the lower ID wins, and between two dialed by the same
+// node the newer one wins, since the older is left over from before a reconnect.
+func (a *peer) wins(b *peer) bool {
+	if a.dialer != b.dialer {
+		return a.dialer < b.dialer
+	}
+	return a.since.After(b.since)
+}
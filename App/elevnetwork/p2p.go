@@ -3,6 +3,7 @@ package elevnetwork
 import (
 	"context"
 	"elevator/common"
+	"log"
 	"sync"
 	"time"
 
@@ -13,7 +14,9 @@ const (
 	openStreamTimeout    = 2 * time.Second
 	dialTimeout          = 4 * time.Second
 	writeTimeout         = 150 * time.Millisecond
+	helloTimeout         = 2 * time.Second
 	incomingBufSize      = 128
+	eventBufSize         = 16
 	KeepAlivePeriod      = 2 * time.Second
 	HandshakeIdleTimeout = 3 * time.Second
 	MaxIdleTimeout       = 6 * time.Second
@@ -22,14 +25,28 @@ const (
 type Manager struct {
 	frameSize int
 	quicConf  *quic.Config
+	selfID    int
+	peerAddrs map[int]string
 	mu        sync.RWMutex
-	peers     map[string]*peer
+	peers     map[int]*peer // by elevator ID, learned in the hello
+	links     map[int]*linkStats
 	incoming  chan []byte
+	events    chan PeerEvent
+	closed    bool
+}
+
+// PeerEvent reports a connection to a peer coming up (after the hello) or going down.
+type PeerEvent struct {
+	ID     int
+	Up     bool
+	Reason string // why the connection went down
 }
 
 type peer struct {
 	conn   *quic.Conn
 	stream *quic.Stream
+	dialer int // elevator ID of the side that dialed
+	since  time.Time
 }
 
 func NewPeerManager() *Manager {
@@ -39,26 +56,32 @@ func NewPeerManager() *Manager {
 			KeepAlivePeriod:      KeepAlivePeriod,
 			HandshakeIdleTimeout: HandshakeIdleTimeout,
 			MaxIdleTimeout:       MaxIdleTimeout,
+			EnableDatagrams:      true,
 		},
-		peers:    make(map[string]*peer),
+		peers:    make(map[int]*peer),
+		links:    make(map[int]*linkStats),
 		incoming: make(chan []byte, incomingBufSize),
+		events:   make(chan PeerEvent, eventBufSize),
 	}
 }
 
-func (m *Manager) Start(ctx context.Context, cfg common.Config, port int) <-chan []byte {
+// Start listens and dials the configured peers. It returns the received frames and the peer
+// connection events.
+func (m *Manager) Start(ctx context.Context, cfg common.Config, port int) (<-chan []byte, <-chan PeerEvent) {
 	peers, selfID, err := cfg.PeerAddrsForPort(port)
 	if err != nil {
 		panic(err)
 	}
 	listenAddr := cfg.ListenAddrForPort(port)
+	m.selfID, m.peerAddrs = selfID, peers
 
 	go m.listen(ctx, listenAddr)
 	for peerID, peerAddr := range peers {
 		if selfID < peerID {
-			go m.dialLoop(ctx, peerAddr)
+			go m.dialLoop(ctx, peerID, peerAddr)
 		}
 	}
-	return m.incoming
+	return m.incoming, m.events
 }
 
 func (m *Manager) Broadcast(payload []byte) {
@@ -75,15 +98,35 @@ func (m *Manager) Broadcast(payload []byte) {
 	}
 }
 
+// Close closes every peer connection with the given reason and stops accepting or dialing new ones.
+func (m *Manager) Close(reason string) {
+	m.mu.Lock()
+	m.closed = true
+	peers := m.peers
+	m.peers = make(map[int]*peer)
+	m.mu.Unlock()
+	for _, p := range peers {
+		if p != nil {
+			Close(p.conn, p.stream, reason)
+		}
+	}
+}
+
+func (m *Manager) isClosed() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.closed
+}
+
 func (m *Manager) listen(ctx context.Context, addr string) {
 	_ = Listen(ctx, addr, m.quicConf, func(conn *quic.Conn) {
 		m.handleIncoming(ctx, conn)
 	})
 }
 
-func (m *Manager) dialLoop(ctx context.Context, addr string) {
-	for ctx.Err() == nil {
-		if m.hasPeer(addr) {
+func (m *Manager) dialLoop(ctx context.Context, id int, addr string) {
+	for ctx.Err() == nil && !m.isClosed() {
+		if m.hasPeer(id) {
 			time.Sleep(500 * time.Millisecond)
 			continue
 		}
@@ -92,19 +135,26 @@ func (m *Manager) dialLoop(ctx context.Context, addr string) {
 			time.Sleep(500 * time.Millisecond)
 			continue
 		}
-		if !m.addPeer(addr, conn, st) {
+		if _, err := m.handshake(st, id); err != nil {
+			log.Printf("elevnetwork: handshake with %s failed: %v", addr, err)
+			Close(conn, st, "handshake")
+			time.Sleep(500 * time.Millisecond)
+			continue
+		}
+		if !m.addPeer(id, &peer{conn: conn, stream: st, dialer: m.selfID, since: time.Now()}) {
 			Close(conn, st, "duplicate")
 			continue
 		}
 		m.startReader(ctx, conn, st)
+		m.startHeartbeats(id, conn)
 
 		select {
 		case <-ctx.Done():
 			Close(conn, st, "bye")
-			m.removeByConn(conn)
+			m.removeByConn(conn, "shutdown")
 			return
 		case <-conn.Context().Done():
-			m.removeByConn(conn)
+			m.removeByConn(conn, "connection closed")
 			time.Sleep(300 * time.Millisecond)
 		}
 	}
@@ -121,15 +171,21 @@ func (m *Manager) handleIncoming(ctx context.Context, conn *quic.Conn) {
 	if err != nil {
 		return
 	}
-	addr := conn.RemoteAddr().String()
-	if !m.addPeer(addr, conn, st) {
+	id, err := m.handshake(st, 0)
+	if err != nil {
+		log.Printf("elevnetwork: handshake from %s failed: %v", conn.RemoteAddr(), err)
+		Close(conn, st, "handshake")
+		return
+	}
+	if !m.addPeer(id, &peer{conn: conn, stream: st, dialer: id, since: time.Now()}) {
 		Close(conn, st, "duplicate")
 		return
 	}
 	m.startReader(ctx, conn, st)
+	m.startHeartbeats(id, conn)
 	go func(c *quic.Conn) {
 		<-c.Context().Done()
-		m.removeByConn(c)
+		m.removeByConn(c, "connection closed")
 	}(conn)
 }
 
@@ -141,28 +197,55 @@ func (m *Manager) startReader(ctx context.Context, conn *quic.Conn, st *quic.Str
 			case <-ctx.Done():
 			}
 		})
-		m.removeByConn(conn)
+		m.removeByConn(conn, "stream closed")
 	}()
 }
 
-func (m *Manager) addPeer(addr string, conn *quic.Conn, st *quic.Stream) bool {
+// addPeer stores p as the connection to peer id. If there already is a live one, the tie-break
+// in peer.wins decides which is kept; the loser is closed (the new one by the caller).
+func (m *Manager) addPeer(id int, p *peer) bool {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	if existing, ok := m.peers[addr]; ok && existing != nil && existing.conn != nil {
+	if m.closed {
+		m.mu.Unlock()
+		return false
+	}
+	existing, ok := m.peers[id]
+	if ok && existing != nil && existing.conn != nil {
 		select {
 		case <-existing.conn.Context().Done():
 		default:
-			return false
+			if !p.wins(existing) {
+				m.mu.Unlock()
+				return false
+			}
+			defer Close(existing.conn, existing.stream, "duplicate")
 		}
 	}
-	m.peers[addr] = &peer{conn: conn, stream: st}
+	m.peers[id] = p
+	m.mu.Unlock()
+	m.emit(PeerEvent{ID: id, Up: true})
 	return true
 }
 
-func (m *Manager) hasPeer(addr string) bool {
+// emit passes on a peer event without blocking; if nobody keeps up, the heartbeat timeout
+// in WorldView still catches the change.
+func (m *Manager) emit(ev PeerEvent) {
+	select {
+	case m.events <- ev:
+	default:
+	}
+}
+
+// knownPeer reports whether id is one of the configured peers.
+func (m *Manager) knownPeer(id int) bool {
+	_, ok := m.peerAddrs[id]
+	return ok
+}
+
+func (m *Manager) hasPeer(id int) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	p := m.peers[addr]
+	p := m.peers[id]
 	if p == nil || p.conn == nil {
 		return false
 	}
@@ -174,16 +257,24 @@ func (m *Manager) hasPeer(addr string) bool {
 	}
 }
 
-func (m *Manager) removeByConn(conn *quic.Conn) {
+// removeByConn forgets conn and reports its peer as down. The reason is the one the
+// connection was closed with if there is one, otherwise the given fallback.
+func (m *Manager) removeByConn(conn *quic.Conn, fallback string) {
 	if conn == nil {
 		return
 	}
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	for addr, p := range m.peers {
+	for id, p := range m.peers {
 		if p != nil && p.conn == conn {
-			delete(m.peers, addr)
+			delete(m.peers, id)
+			m.mu.Unlock()
+			reason := fallback
+			if err := context.Cause(conn.Context()); err != nil {
+				reason = err.Error()
+			}
+			m.emit(PeerEvent{ID: id, Reason: reason})
 			return
 		}
 	}
+	m.mu.Unlock()
 }
@@ -4,17 +4,32 @@ import (
 	"context"
 	"elevator/common"
 	"encoding/json"
+	"strconv"
 	"sync"
 	"time"
 )
 
 const wvTimeout = 4 * time.Second
 
-type sender interface{ Broadcast([]byte) }
+type sender interface {
+	Broadcast([]byte)
+	Close(reason string)
+}
+
+// linkMonitor reports the heartbeats heard from each peer, by elevator ID.
+type linkMonitor interface {
+	PeerStats() map[int]PeerStats
+}
 
 type netMsg struct {
-	Origin   string          `json:"origin"`
+	Origin string `json:"origin"`
+	// Incarnation of the origin node, set at start. A restarted node has a higher epoch,
+	// so its counter starting over is not taken for old messages.
+	Epoch    uint64          `json:"epoch"`
 	Counter  uint64          `json:"counter"`
+	TTL      int             `json:"ttl"`             // hops left, see gossip.go
+	Links    []string        `json:"links,omitempty"` // peers the origin hears directly
+	Leaving  bool            `json:"leaving,omitempty"`
 	Snapshot common.Snapshot `json:"snapshot"`
 }
 
@@ -24,37 +39,62 @@ type WorldView struct {
 	snapshot    common.Snapshot
 	lastHeard   map[string]time.Time
 	lastDigest  map[string]uint64
+	lastSnap    map[string]common.Snapshot // what each node last sent, for coherence diagnostics
 	peerTimeout time.Duration
+	deadline    time.Duration // hall service deadline, 0 for none
 	startTime   time.Time
 	ready       bool
 	selfKey     string
 	selfAlive   bool
+	epoch       uint64
 	counter     uint64
+	latestEpoch map[string]uint64
 	latestCount map[string]uint64
+	selfVersion uint64 // version of our own ElevState
+	departed    map[string]bool
+	linkDown    map[string]time.Time // when the connection to each peer last went down
+	direct      map[string]time.Time // last message straight from each peer
+	seen        seenCache
+	coherence   coherenceStats
 	sender      sender
+	links       linkMonitor // nil when there are no heartbeats
 }
 
-func Start(ctx context.Context, cfg common.Config, port int) (*WorldView, <-chan []byte) {
+func Start(ctx context.Context, cfg common.Config, port int) (*WorldView, <-chan []byte, <-chan PeerEvent) {
 	pm := NewPeerManager()
-	incoming := pm.Start(ctx, cfg, port)
+	incoming, events := pm.Start(ctx, cfg, port)
 	wv := newWorldView(pm, cfg)
-	return wv, incoming
+	wv.links = pm
+	return wv, incoming, events
 }
 
 func newWorldView(s sender, cfg common.Config) *WorldView {
 	return &WorldView{
 		peers: cfg.ExpectedKeys(),
 		snapshot: common.Snapshot{
-			HallRequests: make([][2]bool, common.N_FLOORS),
-			States:       make(map[string]common.ElevState),
+			HallRequests:        make([][2]bool, common.N_FLOORS),
+			HallSince:           make([][2]int64, common.N_FLOORS),
+			HallOverdue:         make([][2]bool, common.N_FLOORS),
+			DestinationRequests: common.NewDestinations(),
+			States:              make(map[string]common.ElevState),
 		},
 		lastHeard:   make(map[string]time.Time),
 		lastDigest:  make(map[string]uint64),
+		lastSnap:    make(map[string]common.Snapshot),
 		peerTimeout: wvTimeout,
+		deadline:    cfg.HallServiceDeadline,
 		startTime:   time.Now(),
 		selfKey:     cfg.SelfKey,
 		selfAlive:   true,
+		latestEpoch: make(map[string]uint64),
 		latestCount: make(map[string]uint64),
+		// start above anything an earlier run of this node can have sent
+		epoch:       uint64(time.Now().UnixNano()),
+		selfVersion: uint64(time.Now().UnixNano()),
+		departed:    make(map[string]bool),
+		linkDown:    make(map[string]time.Time),
+		direct:      make(map[string]time.Time),
+		seen:        newSeenCache(),
 		sender:      s,
 	}
 }
@@ -71,12 +111,6 @@ func (wv *WorldView) Snapshot() common.Snapshot {
 	return snap
 }
 
-func (wv *WorldView) Coherent() bool {
-	wv.mu.Lock()
-	defer wv.mu.Unlock()
-	return wv.snapshotsAgreeLocked()
-}
-
 func (wv *WorldView) SetSelfAlive(alive bool) { wv.mu.Lock(); wv.selfAlive = alive; wv.mu.Unlock() }
 
 func (wv *WorldView) SelfAlive() bool { wv.mu.Lock(); defer wv.mu.Unlock(); return wv.selfAlive }
@@ -92,27 +126,54 @@ func (wv *WorldView) HandleLocal(ns common.Snapshot) {
 	wv.broadcast(kind)
 }
 
+// HandleRemoteFrame decodes and applies a frame from a peer, relaying it if some node may not
+// have it yet. The second return value is true when the change must reach the assigner right
+// away (we became ready, or a peer departed).
 func (wv *WorldView) HandleRemoteFrame(frame []byte) (common.UpdateKind, bool, bool) {
 	msg, ok := decodeNetMsg(frame)
 	if !ok {
 		return 0, false, false
 	}
 	wv.mu.Lock()
+	now := time.Now()
+	if msg.Origin == wv.selfKey {
+		wv.mu.Unlock()
+		return msg.Snapshot.UpdateKind, false, false
+	}
+	// a direct copy counts as a link even when a relayed one got here first
+	wv.observeHopsLocked(msg, now)
+	if wv.seen.check(msg.id(), now) {
+		wv.mu.Unlock()
+		return msg.Snapshot.UpdateKind, false, false
+	}
 	if !wv.acceptLocked(msg) {
 		wv.mu.Unlock()
 		return msg.Snapshot.UpdateKind, false, false
 	}
+	relay, doRelay := wv.relayLocked(msg)
+	doRelay = doRelay && wv.selfAlive
+	if msg.Leaving {
+		// The peer is shutting down: treat it as dead now instead of waiting for the timeout.
+		// It comes back with a new epoch.
+		wv.departed[msg.Origin] = true
+		wv.mu.Unlock()
+		if doRelay {
+			wv.send(relay)
+		}
+		return msg.Snapshot.UpdateKind, true, true
+	}
+	delete(wv.departed, msg.Origin)
 	becameReady := wv.applyLocked(msg.Origin, msg.Snapshot)
-	alive := wv.selfAlive
 	wv.mu.Unlock()
-	if alive {
-		wv.send(msg)
+	if doRelay {
+		wv.send(relay)
 	}
 	return msg.Snapshot.UpdateKind, becameReady, true
 }
 
 func (wv *WorldView) Tick() {
 	wv.mu.Lock()
+	wv.markOverdueLocked(time.Now())
 	ready, alive := wv.ready, wv.selfAlive
 	wv.mu.Unlock()
 	if ready && alive {
@@ -120,6 +181,139 @@ func (wv *WorldView) Tick() {
 	}
 }
 
+// HandlePeerEvent updates liveness from a connection event. It returns true when the alive
+// map changed and must reach the assigner right away.
+func (wv *WorldView) HandlePeerEvent(ev PeerEvent) bool {
+	id := strconv.Itoa(ev.ID)
+	wv.mu.Lock()
+	defer wv.mu.Unlock()
+	now := time.Now()
+	before := wv.aliveMapLocked(now)[id]
+	if ev.Up {
+		// the peer just completed the hello, so it is running
+		wv.lastHeard[id] = now
+		delete(wv.departed, id)
+	} else {
+		wv.linkDown[id] = now
+		delete(wv.direct, id)
+	}
+	return wv.aliveMapLocked(now)[id] != before
+}
+
+// Depart announces to the peers that this node is leaving so they reassign its hall
+// requests immediately. Nothing more is broadcast afterwards.
+func (wv *WorldView) Depart() {
+	wv.mu.Lock()
+	if wv.sender == nil || !wv.selfAlive {
+		wv.mu.Unlock()
+		return
+	}
+	wv.counter++
+	msg := netMsg{Origin: wv.selfKey, Epoch: wv.epoch, Counter: wv.counter, TTL: wv.hopLimit(), Links: wv.linksLocked(time.Now()),
+		Leaving: true, Snapshot: common.DeepCopySnapshot(wv.snapshot)}
+	wv.selfAlive = false
+	wv.mu.Unlock()
+	wv.send(msg)
+}
+
+// SetRecall starts or ends fire-service recall for the whole group and broadcasts it.
+func (wv *WorldView) SetRecall(active bool) {
+	wv.mu.Lock()
+	if wv.snapshot.Recall.Active == active {
+		wv.mu.Unlock()
+		return
+	}
+	wv.mergeSnapshot(wv.selfKey, common.Snapshot{
+		HallRequests: make([][2]bool, common.N_FLOORS),
+		Recall:       common.RecallState{Active: active, Epoch: wv.snapshot.Recall.Epoch + 1},
+		UpdateKind:   common.UpdateRequests,
+	})
+	alive := wv.selfAlive
+	wv.mu.Unlock()
+	if alive {
+		wv.broadcast(common.UpdateRequests)
+	}
+}
+
+// SetTrafficMode proposes the traffic mode this node detected to the whole group.
+func (wv *WorldView) SetTrafficMode(mode string) {
+	wv.mu.Lock()
+	if wv.snapshot.Traffic.Mode == mode {
+		wv.mu.Unlock()
+		return
+	}
+	wv.snapshot.Traffic = common.TrafficState{Mode: mode, Epoch: wv.snapshot.Traffic.Epoch + 1, By: wv.selfKey}
+	ready, alive := wv.ready, wv.selfAlive
+	wv.mu.Unlock()
+	if ready && alive {
+		wv.broadcast(common.UpdateRequests)
+	}
+}
+
+// PublishAssignment shares the assignment computed by this node as master/backup leader.
+// It is broadcast right away if it differs from the one currently shared.
+func (wv *WorldView) PublishAssignment(a common.Assignment) {
+	wv.mu.Lock()
+	cur := wv.snapshot.Assignment
+	if cur != nil && cur.Leader == a.Leader && sameAssignment(*cur, a) {
+		wv.mu.Unlock()
+		return
+	}
+	a = common.CopyAssignment(a)
+	if cur != nil {
+		a.Seq = cur.Seq + 1
+	} else {
+		a.Seq = 1
+	}
+	wv.snapshot.Assignment = &a
+	ready, alive := wv.ready, wv.selfAlive
+	wv.mu.Unlock()
+	if ready && alive {
+		wv.broadcast(common.UpdateRequests)
+	}
+}
+
+// newerAssignment reports whether a replaces cur: it has a higher Seq or, when two leaders
+// published the same Seq during a change of leader, it comes from the lower id, which is
+// the one Leader picks while both are alive.
+func newerAssignment(a, cur common.Assignment) bool {
+	if a.Seq != cur.Seq {
+		return a.Seq > cur.Seq
+	}
+	return common.KeyLess(a.Leader, cur.Leader)
+}
+
+// sameAssignment compares the hall tasks and park floors; ETAs alone do not make a change.
+func sameAssignment(a, b common.Assignment) bool {
+	if len(a.HallTasks) != len(b.HallTasks) || len(a.ParkFloors) != len(b.ParkFloors) {
+		return false
+	}
+	for id, hall := range a.HallTasks {
+		other, ok := b.HallTasks[id]
+		if !ok || len(other) != len(hall) {
+			return false
+		}
+		for f := range hall {
+			if hall[f] != other[f] {
+				return false
+			}
+		}
+	}
+	for id, f := range a.ParkFloors {
+		if g, ok := b.ParkFloors[id]; !ok || f != g {
+			return false
+		}
+	}
+	return true
+}
+
+// Close closes the connections to all peers with the given reason.
+func (wv *WorldView) Close(reason string) {
+	if wv.sender != nil {
+		wv.sender.Close(reason)
+	}
+}
+
 func (wv *WorldView) Poke() {
 	wv.sendSnapshot(common.Snapshot{
 		UpdateKind:   common.UpdateRequests,
@@ -141,9 +335,11 @@ func (wv *WorldView) sendSnapshot(snap common.Snapshot) {
 		return
 	}
 	wv.counter++
-	msg := netMsg{Origin: wv.selfKey, Counter: wv.counter, Snapshot: snap}
-	wv.lastHeard[wv.selfKey] = time.Now()
+	now := time.Now()
+	msg := netMsg{Origin: wv.selfKey, Epoch: wv.epoch, Counter: wv.counter, TTL: wv.hopLimit(), Links: wv.linksLocked(now), Snapshot: snap}
+	wv.lastHeard[wv.selfKey] = now
 	wv.lastDigest[wv.selfKey] = wv.snapshotDigest(snap)
+	wv.lastSnap[wv.selfKey] = common.DeepCopySnapshot(snap)
 	wv.mu.Unlock()
 	wv.send(msg)
 }
@@ -166,21 +362,26 @@ func (wv *WorldView) acceptLocked(msg netMsg) bool {
 	if msg.Origin == wv.selfKey || msg.Origin == "" {
 		return false
 	}
-	now := time.Now()
-	prevCount, seen := wv.latestCount[msg.Origin]
-	prevHeard, heard := wv.lastHeard[msg.Origin]
-	wv.lastHeard[msg.Origin] = now
-	if !seen || msg.Counter > prevCount || !heard || now.Sub(prevHeard) > wv.peerTimeout {
-		wv.latestCount[msg.Origin] = msg.Counter
-		return true
+	wv.lastHeard[msg.Origin] = time.Now()
+	prevEpoch, seen := wv.latestEpoch[msg.Origin]
+	switch {
+	case !seen || msg.Epoch > prevEpoch:
+		// first message from this incarnation of the peer
+	case msg.Epoch < prevEpoch:
+		return false // from before the peer restarted
+	case msg.Counter <= wv.latestCount[msg.Origin]:
+		return false // duplicate or out of order
 	}
-	return false
+	wv.latestEpoch[msg.Origin] = msg.Epoch
+	wv.latestCount[msg.Origin] = msg.Counter
+	return true
 }
 
 func (wv *WorldView) applyLocked(fromKey string, ns common.Snapshot) (becameReady bool) {
 	wv.lastHeard[fromKey] = time.Now()
 	if fromKey != wv.selfKey {
 		wv.lastDigest[fromKey] = wv.snapshotDigest(ns)
+		wv.lastSnap[fromKey] = common.DeepCopySnapshot(ns)
 	}
 	if !wv.ready && fromKey != wv.selfKey && ns.UpdateKind == common.UpdateRequests {
 		wv.recoverCabRequests(ns)
@@ -192,10 +393,34 @@ func (wv *WorldView) applyLocked(fromKey string, ns common.Snapshot) (becameRead
 }
 
 func (wv *WorldView) mergeSnapshot(fromKey string, ns common.Snapshot) {
-	wv.snapshot.HallRequests = mergeHall(wv.snapshot.HallRequests, ns.HallRequests, ns.UpdateKind)
+	wv.snapshot.Recall = mergeRecall(wv.snapshot.Recall, ns.Recall)
+	wv.snapshot.Traffic = mergeTraffic(wv.snapshot.Traffic, ns.Traffic)
+	if ns.Assignment != nil && (wv.snapshot.Assignment == nil || newerAssignment(*ns.Assignment, *wv.snapshot.Assignment)) {
+		a := common.CopyAssignment(*ns.Assignment)
+		wv.snapshot.Assignment = &a
+	}
+	if wv.snapshot.Recall.Active {
+		// recall cancels all hall calls and takes no new ones
+		wv.snapshot.HallRequests = make([][2]bool, common.N_FLOORS)
+		wv.snapshot.DestinationRequests = common.NewDestinations()
+	} else {
+		wv.snapshot.HallRequests = mergeHall(wv.snapshot.HallRequests, ns.HallRequests, ns.UpdateKind)
+		wv.snapshot.DestinationRequests = mergeDestinations(wv.snapshot.DestinationRequests, ns.DestinationRequests, ns.UpdateKind)
+	}
+	wv.snapshot.HallSince = mergeHallSince(wv.snapshot.HallSince, ns.HallSince, wv.snapshot.HallRequests, time.Now())
+	wv.snapshot.HallOverdue = mergeHallOverdue(wv.snapshot.HallOverdue, ns.HallOverdue, wv.snapshot.HallRequests)
 	for k, st := range ns.States {
-		if k == wv.selfKey && fromKey != wv.selfKey {
+		switch {
+		case k == wv.selfKey && fromKey != wv.selfKey:
 			continue
+		case k == wv.selfKey:
+			wv.selfVersion++
+			st.Version = wv.selfVersion
+		default:
+			if cur, ok := wv.snapshot.States[k]; ok && st.Version <= cur.Version {
+				// stale copy (delayed or relayed), keep the newer one we have
+				continue
+			}
 		}
 		wv.snapshot.States[k] = common.CopyElevState(st)
 	}
@@ -210,7 +435,11 @@ func (wv *WorldView) recoverCabRequests(ns common.Snapshot) {
 	if len(localSelf.CabRequests) != common.N_FLOORS {
 		localSelf.CabRequests = make([]bool, common.N_FLOORS)
 	}
-	for i := 0; i < common.N_FLOORS; i++ {
+	for i := 0; i < common.N_FLOORS && i < len(peerSelf.CabRequests); i++ {
+		if i < len(localSelf.CabCancelled) && localSelf.CabCancelled[i] {
+			// cancelled here since the peer last heard from us
+			continue
+		}
 		localSelf.CabRequests[i] = localSelf.CabRequests[i] || peerSelf.CabRequests[i]
 	}
 	wv.snapshot.States[wv.selfKey] = localSelf
@@ -219,13 +448,25 @@ func (wv *WorldView) recoverCabRequests(ns common.Snapshot) {
 func (wv *WorldView) aliveMapLocked(now time.Time) map[string]bool {
 	alive := make(map[string]bool, len(wv.peers))
 	startupGrace := now.Sub(wv.startTime) <= wv.peerTimeout
+	heartbeats := wv.peerStats()
 	for _, id := range wv.peers {
 		if id == wv.selfKey {
 			alive[id] = wv.selfAlive
 			continue
 		}
-		if t, ok := wv.lastHeard[id]; ok {
-			alive[id] = now.Sub(t) <= wv.peerTimeout
+		if wv.departed[id] {
+			alive[id] = false
+			continue
+		}
+		t, ok := wv.lastHeard[id]
+		if hb := heartbeats[id].LastHeard; hb.After(t) {
+			// heartbeats keep a peer alive while its state messages are held up
+			t, ok = hb, true
+		}
+		if ok {
+			// a lost connection makes the peer dead at once, until it is heard from again
+			// (directly or relayed); the timeout catches connections that die silently
+			alive[id] = now.Sub(t) <= wv.peerTimeout && t.After(wv.linkDown[id])
 			continue
 		}
 		alive[id] = startupGrace
@@ -233,6 +474,20 @@ func (wv *WorldView) aliveMapLocked(now time.Time) map[string]bool {
 	return alive
 }
 
+// PeerStats returns the heartbeat statistics of the links to the peers, by key.
+func (wv *WorldView) PeerStats() map[string]PeerStats { return wv.peerStats() }
+
+func (wv *WorldView) peerStats() map[string]PeerStats {
+	out := make(map[string]PeerStats)
+	if wv.links == nil {
+		return out
+	}
+	for id, s := range wv.links.PeerStats() {
+		out[strconv.Itoa(id)] = s
+	}
+	return out
+}
+
 func (wv *WorldView) snapshotsAgreeLocked() bool {
 	alive := wv.aliveMapLocked(time.Now())
 	for _, id := range wv.peers {
@@ -262,6 +517,9 @@ const (
 	digestPrime  = 1099511628211
 )
 
+// snapshotDigest hashes the shared fields the assigner works from: hall requests with their
+// age and overdue flags, recall, traffic mode, destination calls, the leader's assignment and
+// each car's motion and cab requests. Alive is left out, as each node computes its own.
 func (wv *WorldView) snapshotDigest(s common.Snapshot) uint64 {
 	h := uint64(digestOffset)
 	for i := 0; i < common.N_FLOORS; i++ {
@@ -273,7 +531,44 @@ func (wv *WorldView) snapshotDigest(s common.Snapshot) uint64 {
 			h ^= 1
 		}
 		h *= digestPrime
+		for c := range 2 {
+			if i < len(s.HallSince) {
+				h ^= uint64(s.HallSince[i][c])
+			}
+			h *= digestPrime
+			if i < len(s.HallOverdue) && s.HallOverdue[i][c] {
+				h ^= 1
+			}
+			h *= digestPrime
+		}
+	}
+	if s.Recall.Active {
+		h ^= 1
 	}
+	h *= digestPrime
+	h ^= s.Recall.Epoch
+	h *= digestPrime
+	for i := 0; i < len(s.Traffic.Mode); i++ {
+		h ^= uint64(s.Traffic.Mode[i])
+		h *= digestPrime
+	}
+	for from := 0; from < common.N_FLOORS; from++ {
+		for to := 0; to < common.N_FLOORS; to++ {
+			if destinationAt(s.DestinationRequests, from, to) {
+				h ^= 1
+			}
+			h *= digestPrime
+		}
+	}
+	if a := s.Assignment; a != nil {
+		// Seq changes with every new assignment, so leader and Seq identify its content
+		for i := 0; i < len(a.Leader); i++ {
+			h ^= uint64(a.Leader[i])
+			h *= digestPrime
+		}
+		h ^= a.Seq
+	}
+	h *= digestPrime
 	for _, id := range wv.peers {
 		st, ok := s.States[id]
 		if !ok {
@@ -291,10 +586,20 @@ func (wv *WorldView) snapshotDigest(s common.Snapshot) uint64 {
 		}
 		h ^= uint64(st.Floor + 1000)
 		h *= digestPrime
+		for i := 0; i < common.N_FLOORS; i++ {
+			if i < len(st.CabRequests) && st.CabRequests[i] {
+				h ^= 1
+			}
+			h *= digestPrime
+		}
 	}
 	return h
 }
 
+func destinationAt(dest [][]bool, from, to int) bool {
+	return from < len(dest) && to < len(dest[from]) && dest[from][to]
+}
+
 func mergeHall(current, incoming [][2]bool, kind common.UpdateKind) [][2]bool {
 	merged := make([][2]bool, common.N_FLOORS)
 	for i := 0; i < common.N_FLOORS; i++ {
@@ -308,3 +613,104 @@ func mergeHall(current, incoming [][2]bool, kind common.UpdateKind) [][2]bool {
 	}
 	return merged
 }
+
+// mergeDestinations merges destination calls like hall requests. A snapshot without
+// destination calls (nil) leaves them unchanged.
+func mergeDestinations(current, incoming [][]bool, kind common.UpdateKind) [][]bool {
+	if incoming == nil {
+		return common.CopyDestinations(current)
+	}
+	merged := common.NewDestinations()
+	at := func(m [][]bool, from, to int) bool {
+		return from < len(m) && to < len(m[from]) && m[from][to]
+	}
+	for from := range common.N_FLOORS {
+		for to := range common.N_FLOORS {
+			if kind == common.UpdateServiced {
+				merged[from][to] = at(current, from, to) && at(incoming, from, to)
+			} else {
+				merged[from][to] = at(current, from, to) || at(incoming, from, to)
+			}
+		}
+	}
+	return merged
+}
+
+// mergeRecall keeps the recall state with the higher epoch. Two changes made with the same
+// epoch on different nodes resolve to active, the safe side.
+func mergeRecall(current, incoming common.RecallState) common.RecallState {
+	if incoming.Epoch > current.Epoch || (incoming.Epoch == current.Epoch && incoming.Active) {
+		return incoming
+	}
+	return current
+}
+
+// mergeHallOverdue keeps a hall request overdue once any node has marked it, for as long as
+// the request is active.
+func mergeHallOverdue(current, incoming [][2]bool, hall [][2]bool) [][2]bool {
+	merged := make([][2]bool, common.N_FLOORS)
+	at := func(s [][2]bool, f, c int) bool { return f < len(s) && s[f][c] }
+	for f := range common.N_FLOORS {
+		for c := range 2 {
+			merged[f][c] = hall[f][c] && (at(current, f, c) || at(incoming, f, c))
+		}
+	}
+	return merged
+}
+
+// markOverdueLocked marks the active hall requests that have passed the service deadline
+// by this node's clock. The marks spread with the next broadcast.
+func (wv *WorldView) markOverdueLocked(now time.Time) {
+	if wv.deadline <= 0 {
+		return
+	}
+	if len(wv.snapshot.HallOverdue) != common.N_FLOORS {
+		wv.snapshot.HallOverdue = make([][2]bool, common.N_FLOORS)
+	}
+	for f := range common.N_FLOORS {
+		for c := range 2 {
+			since := wv.snapshot.HallSince[f][c]
+			if wv.snapshot.HallRequests[f][c] && since != 0 && now.Sub(time.UnixMilli(since)) >= wv.deadline {
+				wv.snapshot.HallOverdue[f][c] = true
+			}
+		}
+	}
+}
+
+// mergeTraffic keeps the traffic mode with the higher epoch. Two proposals with the same
+// epoch resolve to the one from the lower node key; any fixed order will do.
+func mergeTraffic(current, incoming common.TrafficState) common.TrafficState {
+	if incoming.Epoch > current.Epoch || (incoming.Epoch == current.Epoch && incoming.By != "" && (current.By == "" || incoming.By < current.By)) {
+		return incoming
+	}
+	return current
+}
+
+// mergeHallSince keeps the earliest known time each active hall request was raised, and
+// stamps requests nobody has timed yet with now. Inactive requests get 0.
+func mergeHallSince(current, incoming [][2]int64, hall [][2]bool, now time.Time) [][2]int64 {
+	merged := make([][2]int64, common.N_FLOORS)
+	at := func(s [][2]int64, f, c int) int64 {
+		if f < len(s) {
+			return s[f][c]
+		}
+		return 0
+	}
+	for f := range common.N_FLOORS {
+		for c := range 2 {
+			if !hall[f][c] {
+				continue
+			}
+			a, b := at(current, f, c), at(incoming, f, c)
+			switch {
+			case a == 0 && b == 0:
+				merged[f][c] = now.UnixMilli()
+			case a == 0 || (b != 0 && b < a):
+				merged[f][c] = b
+			default:
+				merged[f][c] = a
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,105 @@
+package elevnetwork
+
+import (
+	"elevator/common"
+	"testing"
+)
+
+func testState(version uint64, floor int, cab ...int) common.ElevState {
+	st := common.ElevState{
+		Version:     version,
+		Behavior:    "idle",
+		Floor:       floor,
+		Direction:   "stop",
+		CabRequests: make([]bool, common.N_FLOORS),
+	}
+	for _, f := range cab {
+		st.CabRequests[f] = true
+	}
+	return st
+}
+
+func testMsg(origin string, counter uint64, states map[string]common.ElevState) netMsg {
+	return netMsg{
+		Origin:  origin,
+		Epoch:   1,
+		Counter: counter,
+		TTL:     2,
+		Links:   []string{"1", "2", "3"}, // full mesh, nothing is relayed
+		Snapshot: common.Snapshot{
+			HallRequests: make([][2]bool, common.N_FLOORS),
+			States:       states,
+			UpdateKind:   common.UpdateRequests,
+		},
+	}
+}
+
+func TestStaleStateIsNotRolledBack(t *testing.T) {
+	net := newTestNet(3, nil)
+	wv := net.nodes["1"]
+
+	// node 2 relays node 3's newer state before node 3's own, older message arrives
+	wv.HandleRemoteFrame(encodeTestMsg(t, testMsg("2", 1, map[string]common.ElevState{
+		"3": testState(11, 2, 0, 3),
+	})))
+	wv.HandleRemoteFrame(encodeTestMsg(t, testMsg("3", 1, map[string]common.ElevState{
+		"3": testState(10, 1, 0),
+	})))
+
+	st := wv.Snapshot().States["3"]
+	if st.Version != 11 || st.Floor != 2 {
+		t.Errorf("state of 3 rolled back to version %d floor %d, want version 11 floor 2", st.Version, st.Floor)
+	}
+	if !st.CabRequests[3] {
+		t.Errorf("cab request at floor 3 was lost to the stale copy")
+	}
+
+	// a newer version replaces it
+	wv.HandleRemoteFrame(encodeTestMsg(t, testMsg("3", 2, map[string]common.ElevState{
+		"3": testState(12, 3),
+	})))
+	if st := wv.Snapshot().States["3"]; st.Version != 12 || st.Floor != 3 || st.CabRequests[3] {
+		t.Errorf("newer state not applied: %+v", st)
+	}
+}
+
+func TestOwnStateIsNotReplacedByPeers(t *testing.T) {
+	net := newTestNet(3, nil)
+	wv := net.nodes["1"]
+
+	wv.HandleLocal(common.Snapshot{
+		HallRequests: make([][2]bool, common.N_FLOORS),
+		States:       map[string]common.ElevState{"1": testState(0, 1, 2)},
+		UpdateKind:   common.UpdateRequests,
+	})
+	own := wv.Snapshot().States["1"]
+
+	// a peer relays a copy of our state with a version far ahead of ours
+	wv.HandleRemoteFrame(encodeTestMsg(t, testMsg("2", 1, map[string]common.ElevState{
+		"1": testState(own.Version+100, 3),
+	})))
+
+	st := wv.Snapshot().States["1"]
+	if st.Version != own.Version || st.Floor != 1 || !st.CabRequests[2] {
+		t.Errorf("own state replaced by a peer's copy: %+v, want %+v", st, own)
+	}
+}
+
+func TestAssignmentTieGoesToLowerLeader(t *testing.T) {
+	withAssignment := func(origin string, counter uint64, leader string, seq uint64) []byte {
+		msg := testMsg(origin, counter, nil)
+		msg.Snapshot.Assignment = &common.Assignment{Leader: leader, Seq: seq}
+		return encodeTestMsg(t, msg)
+	}
+	for _, order := range [][2]string{{"2", "3"}, {"3", "2"}} {
+		net := newTestNet(3, nil)
+		wv := net.nodes["1"]
+		// node 1 is presumed dead by the others; 2 and 3 both lead for a moment
+		for i, leader := range order {
+			wv.HandleRemoteFrame(withAssignment(leader, uint64(i+1), leader, 5))
+		}
+		if a := wv.Snapshot().Assignment; a == nil || a.Leader != "2" {
+			t.Errorf("delivered from %v: kept assignment %+v, want the one from 2", order, a)
+		}
+	}
+}
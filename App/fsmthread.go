@@ -16,6 +16,11 @@ func fsmThread(
 	assignerOutputCh <-chan common.ElevInput,
 	elevUpdateCh chan<- common.Snapshot,
 	netWorldView2Ch <-chan common.Snapshot, // network -> fsm
+	maintenanceCh <-chan bool, // status API -> fsm
+	loadCh <-chan int, // status API -> fsm
+	destinationCh <-chan [2]int, // status API -> fsm
+	shutdownCh <-chan struct{},
+	fsmDrainedCh chan<- struct{},
 ) {
 	log.Printf("fsmThread started (self=%s)", cfg.SelfKey)
 
@@ -24,29 +29,53 @@ func fsmThread(
 	inputPollRateMs := 25
 
 	sync := elevfsm.NewFsmSync(cfg)
-	sync.Elevator = elevfsm.Fsm_init()
+	sync.Elevator = elevfsm.Fsm_init(cfg)
+
+	// Restore cab requests saved by a graceful shutdown; they are confirmed like fresh presses.
+	if cab, err := elevfsm.LoadCabRequests(cfg.CabRequestsFile); err == nil {
+		now := time.Now()
+		for f, active := range cab {
+			if active {
+				sync.OnLocalPress(f, common.BT_Cab, now)
+			}
+		}
+	}
 
 	var previousRequests [common.N_FLOORS][common.N_BUTTONS]int
 
+	// Cab call cancellation: a second press within cfg.CabCancelWindow on a button that was
+	// already lit at the first press withdraws the call.
+	var lastCabPress [common.N_FLOORS]time.Time
+	var cabLitAtPress [common.N_FLOORS]bool
+
 	confirmTimeout := 200 * time.Millisecond
 	prevObstructed := false
-	timerPaused := false
+	prevStopPressed := false
+	var stopPressedAt time.Time
+
+	// Graceful shutdown: hall requests are handed off, the current door cycle finishes.
+	draining := false
+	var drainDeadline time.Time
 
-	// Local timer state so this thread uses only the standard `time` package
-	// instead of package-level helper functions.
-	var doorTimerEnd time.Time
-	var doorTimerActive bool
 	var servicedCall elevfsm.ServicedAt
+	watchdog := elevfsm.NewMotorWatchdog(cfg.FloorTravelTimeout)
+	obstructionWatchdog := elevfsm.NewObstructionWatchdog(cfg.ObstructionFaultTimeout)
+	loadSim := elevfsm.NewLoadSimulator(time.Now().UnixNano())
+	parking := elevfsm.NewParkingPolicy(cfg.ParkingIdleDelay)
+	durations := elevfsm.NewDurationEstimator(cfg.FloorTravelDuration, cfg.DoorOpenDuration)
+	sync.SetDurationEstimates(durations.TravelDuration(), durations.DoorOpenDuration())
 	// Seed floor state if the sensor is already at a floor; otherwise start moving to find one.
+	// prevFloor is the last floor reached (reported to the network); prevSensor is the raw
+	// sensor reading, so returning to the same floor after being between floors is detected.
 	prevFloor := -1
-	if f := elevInputDevice.FloorSensor(); f != -1 {
+	prevSensor := elevInputDevice.FloorSensor()
+	if f := prevSensor; f != -1 {
 		elevfsm.Fsm_onFloorArrival(sync.Elevator, f)
 		prevFloor = f
 	} else {
 		elevfsm.Fsm_onInitBetweenFloors(sync.Elevator)
 	}
 	behavior, direction := elevfsm.CurrentMotionStrings(sync.Elevator)
-	prevBehaviour := elevfsm.CurrentBehaviour(sync.Elevator)
 	initialSnap := sync.BuildSnapshot(prevFloor, behavior, direction, common.UpdateRequests, servicedCall, false)
 
 	select {
@@ -62,24 +91,82 @@ func fsmThread(
 		case <-ctx.Done():
 			return
 
+		case <-shutdownCh:
+			log.Printf("fsmThread: shutting down, handing off hall requests")
+			shutdownCh = nil
+			draining = true
+			drainDeadline = time.Now().Add(cfg.ShutdownTimeout)
+			sync.DropHallCalls()
+
+		case on := <-maintenanceCh:
+			if !setMaintenance(sync, on) || !sync.HasNetSelf() {
+				continue
+			}
+			online := !sync.Offline(time.Now())
+			behavior, direction = elevfsm.CurrentMotionStrings(sync.Elevator)
+			snapshot := sync.BuildSnapshot(prevFloor, behavior, direction, common.UpdateRequests, servicedCall, online)
+			select {
+			case elevUpdateCh <- snapshot:
+			default:
+			}
+
+		case load := <-loadCh:
+			wasFull := elevfsm.CarFull(sync.Elevator)
+			elevfsm.Fsm_onLoad(sync.Elevator, load)
+			if elevfsm.CarFull(sync.Elevator) != wasFull {
+				log.Printf("fsmThread: car full %v (load %d%%)", !wasFull, load)
+			}
+			if !sync.HasNetSelf() {
+				continue
+			}
+			online := !sync.Offline(time.Now())
+			behavior, direction = elevfsm.CurrentMotionStrings(sync.Elevator)
+			snapshot := sync.BuildSnapshot(prevFloor, behavior, direction, common.UpdateRequests, servicedCall, online)
+			select {
+			case elevUpdateCh <- snapshot:
+			default:
+			}
+
+		case call := <-destinationCh:
+			if draining || elevfsm.InRecall(sync.Elevator) {
+				continue
+			}
+			sync.OnDestinationPress(call[0], call[1], time.Now())
+
 		case snap := <-netWorldView2Ch:
 			now := time.Now()
 			online := !sync.Offline(now)
 
 			sync.ApplyNetworkSnapshot(snap, now)
+			if snap.Recall.Active != elevfsm.InRecall(sync.Elevator) {
+				log.Printf("fsmThread: fire-service recall %v", snap.Recall.Active)
+				sync.SetRecall(snap.Recall.Active)
+			}
 
 			sync.TryInjectAll(now, confirmTimeout, online)
 			sync.ApplyLights(online)
 
 		case task := <-assignerOutputCh:
+			if draining {
+				continue
+			}
 			now := time.Now()
 			online := !sync.Offline(now)
 
-			sync.ApplyAssigner(task)
+			etaChanged := sync.ApplyAssigner(task, now)
+			parking.SetHomeFloor(sync.Elevator, task.ParkFloor)
 
 			sync.TryInjectAll(now, confirmTimeout, online)
 			sync.ApplyLights(online)
 
+			if etaChanged && sync.HasNetSelf() {
+				snapshot := sync.BuildSnapshot(prevFloor, behavior, direction, common.UpdateRequests, servicedCall, online)
+				select {
+				case elevUpdateCh <- snapshot:
+				default:
+				}
+			}
+
 		case <-ticker.C:
 			now := time.Now()
 			online := !sync.Offline(now) //TODO: Change name of online
@@ -87,9 +174,26 @@ func fsmThread(
 			elevStateChange := false
 
 			// Request buttons (edge-detected)
+			recall := elevfsm.InRecall(sync.Elevator)
 			for f := range common.N_FLOORS {
 				for b := range common.N_BUTTONS {
 					v := elevInputDevice.RequestButton(f, common.ButtonType(b))
+					if (draining && common.ButtonType(b) != common.BT_Cab) || recall {
+						// no new hall calls while shutting down, no calls at all in recall
+						v = 0
+					}
+					if v != 0 && v != previousRequests[f][b] && common.ButtonType(b) == common.BT_Cab && cfg.CabCancelWindow > 0 {
+						lit := sync.CabActive(f)
+						if lit && cabLitAtPress[f] && now.Sub(lastCabPress[f]) <= cfg.CabCancelWindow {
+							sync.CancelCab(f)
+							lastCabPress[f] = time.Time{}
+							elevStateChange = true
+							previousRequests[f][b] = v
+							continue
+						}
+						lastCabPress[f] = now
+						cabLitAtPress[f] = lit
+					}
 					if v != 0 && v != previousRequests[f][b] {
 						sync.OnLocalPress(f, common.ButtonType(b), now)
 						elevStateChange = true
@@ -103,42 +207,67 @@ func fsmThread(
 
 			// Floor sensor
 			f := elevInputDevice.FloorSensor()
-			if f != -1 && f != prevFloor {
+			arrived := f != -1 && f != prevSensor
+			if arrived {
 				elevfsm.Fsm_onFloorArrival(sync.Elevator, f)
 				prevFloor = f
 				elevStateChange = true
 			}
+			prevSensor = f
 
-			// Obstruction handling: keep door open while obstructed; restart timer when cleared.
-			obstructed := elevInputDevice.Obstruction() != 0
-			if elevfsm.CurrentBehaviour(sync.Elevator) == elevfsm.EB_DoorOpen {
-				if obstructed {
-					if !timerPaused {
-						// stop local timer
-						doorTimerActive = false
-						timerPaused = true
+			// Stop button (edge-detected): halt immediately, resume on release.
+			// Holding it for cfg.MaintenanceHoldTime toggles maintenance mode on release.
+			stopPressed := elevInputDevice.StopButton() != 0
+			if stopPressed && !prevStopPressed {
+				elevfsm.Fsm_onStopButtonPress(sync.Elevator, f != -1)
+				stopPressedAt = now
+			} else if !stopPressed && prevStopPressed {
+				elevfsm.Fsm_onStopButtonRelease(sync.Elevator)
+				if now.Sub(stopPressedAt) >= cfg.MaintenanceHoldTime {
+					if setMaintenance(sync, !elevfsm.InMaintenance(sync.Elevator)) {
+						elevStateChange = true
 					}
-				} else if timerPaused || prevObstructed {
-					// start local timer using doorOpenDuration (seconds)
-					d := time.Duration(3 * time.Second)
-					doorTimerEnd = time.Now().Add(d)
-					doorTimerActive = true
-					timerPaused = false
 				}
-			} else {
-				timerPaused = false
+			}
+			prevStopPressed = stopPressed
+
+			// Obstruction switch (edge-detected): the FSM holds the door open while obstructed.
+			obstructed := elevInputDevice.Obstruction() != 0
+			if obstructed != prevObstructed {
+				elevfsm.Fsm_onObstruction(sync.Elevator, obstructed)
 			}
 			prevObstructed = obstructed
 
-			// Timer (use local time-based timer instead of elevfsm helpers)
-			if doorTimerActive && time.Now().After(doorTimerEnd) {
-				// stop timer
-				doorTimerActive = false
-				timerPaused = false
-				arrivalDirn := elevfsm.CurrentDirection(sync.Elevator)
-				elevfsm.Fsm_onDoorTimeout(sync.Elevator)
+			// Door timer
+			if elevfsm.Fsm_pollDoorTimer(sync.Elevator, now) {
+				servicedCall = sync.ClearAtFloor(prevFloor, online)
+				sync.PickUpDestinations(prevFloor, servicedCall, now)
+				if cfg.LoadSource == "simulated" {
+					if load, changed := loadSim.Observe(sync.Elevator, servicedCall); changed {
+						elevfsm.Fsm_onLoad(sync.Elevator, load)
+						elevStateChange = true
+					}
+				}
+			}
+
+			// Motor watchdog: flag a stuck car so its hall calls are handed off.
+			if watchdog.Observe(sync.Elevator, arrived, now) {
+				elevStateChange = true
+			}
+			// Obstruction watchdog: a door blocked for too long gives up its hall calls.
+			if obstructionWatchdog.Observe(sync.Elevator, obstructed, now) {
+				elevStateChange = true
+			}
+
+			// Travel/door time estimates shared with the assigner
+			if durations.Observe(sync.Elevator, arrived, now) {
+				sync.SetDurationEstimates(durations.TravelDuration(), durations.DoorOpenDuration())
+				elevStateChange = true
+			}
 
-				servicedCall = sync.ClearAtFloor(prevFloor, online, arrivalDirn)
+			// Idle cars go to their home floor after a while
+			if !draining && parking.Observe(sync.Elevator, now) {
+				elevStateChange = true
 			}
 
 			// Inject confirmed requests
@@ -147,18 +276,24 @@ func fsmThread(
 			sync.ApplyLights(online)
 
 			behavior, direction = elevfsm.CurrentMotionStrings(sync.Elevator) //TODO: We have elevator as a member of sync, so this is so not needed.
-			newBehaviour := elevfsm.CurrentBehaviour(sync.Elevator)
-			if prevBehaviour != newBehaviour && newBehaviour == elevfsm.EB_DoorOpen {
-				// start door timer when entering DoorOpen
-				d := time.Duration(3 * time.Second)
-				doorTimerEnd = time.Now().Add(d)
-				doorTimerActive = true
-				timerPaused = false
-			}
 			if sync.MotionChanged(prevFloor, behavior, direction) {
 				elevStateChange = true
 			}
-			prevBehaviour = newBehaviour
+
+			// Shutdown: once the door is closed and the car is at a floor (or not moving),
+			// park it, persist cab calls and let the network thread close the connections.
+			if draining {
+				b := elevfsm.CurrentBehaviour(sync.Elevator)
+				settled := b != elevfsm.EB_DoorOpen && (f != -1 || b != elevfsm.EB_Moving)
+				if settled || now.After(drainDeadline) {
+					elevfsm.Fsm_onShutdown(sync.Elevator)
+					if err := elevfsm.SaveCabRequests(cfg.CabRequestsFile, sync.LocalCabCopy()); err != nil {
+						log.Printf("fsmThread: saving cab requests failed: %v", err)
+					}
+					close(fsmDrainedCh)
+					return
+				}
+			}
 
 			if !sync.HasNetSelf() {
 				continue
@@ -181,3 +316,17 @@ func fsmThread(
 		}
 	}
 }
+
+// setMaintenance takes the car out of service (handing off its hall requests) or puts it back.
+// Returns true if the mode changed, so the caller can tell the peers.
+func setMaintenance(sync *elevfsm.FsmSync, on bool) bool {
+	if elevfsm.InMaintenance(sync.Elevator) == on {
+		return false
+	}
+	log.Printf("fsmThread: maintenance mode %v", on)
+	elevfsm.Fsm_onMaintenance(sync.Elevator, on)
+	if on {
+		sync.DropHallCalls()
+	}
+	return true
+}
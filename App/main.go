@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"time"
 	//quic "github.com/quic-go/quic-go"
 )
 
@@ -18,13 +19,19 @@ func main() {
 	common.ElevioInit("localhost:15657")
 	input := common.ElevioGetInputDevice()
 
-	// ctrl + c handling
+	// ctrl + c handling: the first one starts a graceful shutdown, a second one exits right away
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	shutdownCh := make(chan struct{})
+	fsmDrainedCh := make(chan struct{})
+	netClosedCh := make(chan struct{})
+
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt)
 	go func() {
+		<-sig
+		close(shutdownCh)
 		<-sig
 		cancel()
 	}()
@@ -41,16 +48,51 @@ func main() {
 	// vetle til filip
 	assignerOutCh := make(chan ElevInput, 4)
 
+	// vetle til lucas: assignment to distribute when leading in master/backup mode
+	assignmentCh := make(chan Assignment, 1)
+
+	// network til status API
+	statusSnapCh := make(chan Snapshot, 1)
+
+	// status API til filip: maintenance mode on/off
+	maintenanceCh := make(chan bool, 1)
+
+	// status API til filip: car load in percent (load sensor stand-in)
+	loadCh := make(chan int, 1)
+
+	// status API til filip: destination calls {from, to}
+	destinationCh := make(chan [2]int, 4)
+
+	// status API til lucas: fire-service recall on/off
+	recallCh := make(chan bool, 1)
+
+	// vetle til lucas: traffic mode detected here, proposed to the group
+	trafficCh := make(chan string, 1)
+
 	cfg, _, err := common.DefaultConfig()
 	if err != nil {
 		fmt.Println("Error loading config")
 
 	}
 
-	go networkThread(ctx, cfg, elevUpdateCh, netSnap1Ch, netSnap2Ch)
-	go assignerThread(ctx, cfg, netSnap1Ch, assignerOutCh)
-	go fsmThread(ctx, cfg, input, assignerOutCh, elevUpdateCh, netSnap2Ch)
-	<-ctx.Done()
-	fmt.Println("Shutting down")
+	go networkThread(ctx, cfg, elevUpdateCh, netSnap1Ch, netSnap2Ch, statusSnapCh, recallCh, trafficCh, assignmentCh, shutdownCh, fsmDrainedCh, netClosedCh)
+	go assignerThread(ctx, cfg, netSnap1Ch, assignerOutCh, assignmentCh, trafficCh)
+	go fsmThread(ctx, cfg, input, assignerOutCh, elevUpdateCh, netSnap2Ch, maintenanceCh, loadCh, destinationCh, shutdownCh, fsmDrainedCh)
+	go statusThread(ctx, cfg, statusSnapCh, maintenanceCh, loadCh, destinationCh, recallCh)
+
+	select {
+	case <-shutdownCh:
+		fmt.Println("Shutting down")
+	case <-ctx.Done():
+	}
+
+	// fsmThread finishes the door cycle within cfg.ShutdownTimeout, then networkThread closes the connections
+	select {
+	case <-netClosedCh:
+	case <-ctx.Done():
+	case <-time.After(cfg.ShutdownTimeout + 2*time.Second):
+		fmt.Println("Shutdown timed out")
+	}
+	cancel()
 
 }
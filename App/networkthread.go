@@ -12,16 +12,28 @@ import (
 
 const INITIAL_CONTACT_TIMEOUT = 8 * time.Second
 
+// Short incoherent periods are normal while a change spreads; longer ones are logged
+// with the diverging fields, repeated at this interval while they last.
+const INCOHERENCE_LOG_INTERVAL = 2 * time.Second
+
+// Interval between logs of the heartbeat RTT and loss per peer.
+const LINK_STATS_LOG_INTERVAL = 30 * time.Second
+
 func networkThread(
 	ctx context.Context,
 	cfg common.Config,
 	elevUpdateCh <-chan common.Snapshot,
 	netSnap1Ch chan<- common.Snapshot,
 	netSnap2Ch chan<- common.Snapshot,
+	statusSnapCh chan<- common.Snapshot,
+	recallCh <-chan bool, // status API -> network
+	trafficCh <-chan string, // assigner -> network: traffic mode proposal
+	assignmentCh <-chan common.Assignment, // assigner -> network (master/backup leader)
+	shutdownCh <-chan struct{},
+	fsmDrainedCh <-chan struct{},
+	netClosedCh chan<- struct{},
 ) {
-	selfKey := cfg.SelfKey
-
-	wv, incoming := elevnetwork.Start(ctx, cfg, 4242)
+	wv, incoming, peerEvents := elevnetwork.Start(ctx, cfg, 4242)
 	wv.Poke()
 
 	ticker := time.NewTicker(300 * time.Millisecond)
@@ -30,8 +42,8 @@ func networkThread(
 	contactTimer := time.NewTimer(INITIAL_CONTACT_TIMEOUT)
 	defer contactTimer.Stop()
 
-	elevatorErrorTimer := time.NewTimer(4 * time.Second)
-	defer elevatorErrorTimer.Stop()
+	statsTicker := time.NewTicker(LINK_STATS_LOG_INTERVAL)
+	defer statsTicker.Stop()
 
 	publish := func(ch chan<- common.Snapshot, snap common.Snapshot) {
 		select {
@@ -40,12 +52,32 @@ func networkThread(
 		}
 	}
 
+	var incoherenceLogged time.Time
+	logCoherence := func(c elevnetwork.Coherence) {
+		now := time.Now()
+		switch {
+		case c.Coherent && !incoherenceLogged.IsZero():
+			log.Printf("networkThread: world view coherent again (incoherent %d times, %v in total)",
+				c.Periods, c.Incoherent.Round(time.Millisecond))
+			incoherenceLogged = time.Time{}
+		case !c.Coherent && now.Sub(c.Since) >= INCOHERENCE_LOG_INTERVAL && now.Sub(incoherenceLogged) >= INCOHERENCE_LOG_INTERVAL:
+			log.Printf("networkThread: world view incoherent for %v; compared with %s: %v",
+				now.Sub(c.Since).Round(time.Millisecond), c.Reference, c.Divergences)
+			incoherenceLogged = now
+		}
+	}
+
 	publishAll := func() {
 		snap := wv.Snapshot()
-		if wv.Ready() && wv.Coherent() {
+		coherence := wv.Coherence()
+		logCoherence(coherence)
+		// peer-to-peer needs every node to assign from the same view; in master/backup
+		// only the leader assigns, so its followers need not wait for agreement
+		if wv.Ready() && (cfg.CoordinationMode == "masterBackup" || coherence.Coherent) {
 			publish(netSnap1Ch, snap)
 		}
 		publish(netSnap2Ch, snap)
+		publish(statusSnapCh, snap)
 	}
 
 	for {
@@ -53,17 +85,47 @@ func networkThread(
 		case <-ctx.Done():
 			return
 
+		case <-shutdownCh:
+			// Announce departure first so peers take over our hall requests right away.
+			log.Printf("networkThread: shutting down, announcing departure")
+			shutdownCh = nil
+			wv.Depart()
+
+		case <-fsmDrainedCh:
+			wv.Close("shutdown")
+			close(netClosedCh)
+			return
+
+		case on := <-recallCh:
+			log.Printf("networkThread: fire-service recall %v requested", on)
+			wv.SetRecall(on)
+			publishAll()
+
+		case mode := <-trafficCh:
+			wv.SetTrafficMode(mode)
+
+		case a := <-assignmentCh:
+			wv.PublishAssignment(a)
+
 		case ns := <-elevUpdateCh:
-			wv.SetSelfAlive(true)
-			elevatorErrorTimer.Reset(4 * time.Second)
 			wv.HandleLocal(ns)
 
 		case frame := <-incoming:
-			kind, becameReady, ok := wv.HandleRemoteFrame(frame)
+			_, publishNow, ok := wv.HandleRemoteFrame(frame)
 			if !ok {
 				continue
 			}
-			if kind == common.UpdateRequests && becameReady {
+			if publishNow {
+				publishAll()
+			}
+
+		case ev := <-peerEvents:
+			if ev.Up {
+				log.Printf("networkThread: peer %d connected", ev.ID)
+			} else {
+				log.Printf("networkThread: peer %d disconnected: %s", ev.ID, ev.Reason)
+			}
+			if wv.HandlePeerEvent(ev) {
 				publishAll()
 			}
 
@@ -71,27 +133,17 @@ func networkThread(
 			log.Printf("networkThread: initial contact timeout; forcing ready")
 			wv.ForceReady()
 
+		case <-statsTicker.C:
+			for id, s := range wv.PeerStats() {
+				log.Printf("networkThread: link to peer %s: rtt %v, loss %.1f%% of %d heartbeats",
+					id, s.RTT.Round(10*time.Microsecond), 100*s.Loss(), s.Sent)
+			}
+
 		case <-ticker.C:
 			wv.Tick()
 			if wv.Ready() {
 				publishAll()
 			}
-
-		case <-elevatorErrorTimer.C:
-			snap := wv.Snapshot()
-			if snap.States[selfKey].Behavior != "idle" {
-				if wv.SelfAlive() {
-					wv.SetSelfAlive(false)
-					log.Printf("No behavior change detected for 4 seconds, marking Elevator as stale")
-					publishAll()
-				}
-			} else {
-				if !wv.SelfAlive() {
-					wv.SetSelfAlive(true)
-					publishAll()
-				}
-				elevatorErrorTimer.Reset(4 * time.Second)
-			}
 		}
 	}
 }
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"elevator/common"
+)
+
+// hallETA is one active hall request, the elevator that has it and when it is expected there.
+// ETA is a wall-clock estimate made on the assigned elevator's node, so it is only as accurate
+// as that node's clock.
+type hallETA struct {
+	Floor    int       `json:"floor"`
+	Button   string    `json:"button"`
+	Elevator string    `json:"elevator,omitempty"`
+	ETA      time.Time `json:"eta,omitzero"`
+	Since    time.Time `json:"since,omitzero"`
+	Overdue  bool      `json:"overdue,omitempty"` // past the service deadline, escalated
+	Alarm    bool      `json:"alarm,omitempty"`   // past the alarm limit
+}
+
+// destinationCall is one waiting destination dispatch call and the elevator that will pick it up.
+type destinationCall struct {
+	From     int       `json:"from"`
+	To       int       `json:"to"`
+	Elevator string    `json:"elevator,omitempty"`
+	ETA      time.Time `json:"eta,omitzero"`
+}
+
+// How long POST /destination waits for the group to assign the call before it answers
+// without an elevator.
+const DESTINATION_ASSIGN_TIMEOUT = 5 * time.Second
+
+type statusReport struct {
+	Self         string            `json:"self"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
+	Snapshot     common.Snapshot   `json:"snapshot"`
+	HallETAs     []hallETA         `json:"hallEtas"`
+	Destinations []destinationCall `json:"destinations"`
+	HallAlarms   int               `json:"hallAlarms"` // alarms raised since start
+}
+
+// statusThread serves the latest world view over HTTP (GET /status) for dashboards and tests,
+// lets an operator take this car out of service (POST /maintenance?on=true|false) and,
+// with cfg.LoadSource "api", stands in for the load sensor (POST /load?percent=0..100).
+// In destination dispatch mode it also takes destination calls (POST /destination?from=F&to=T)
+// and answers once the call is assigned: 200 with {"from","to","elevator","eta"}, the car to
+// board. Calls for the same from and to are one call, so every caller gets the same car. If no
+// car is assigned within DESTINATION_ASSIGN_TIMEOUT it answers 202 without an elevator; the
+// call is then listed under "destinations" in GET /status once it is assigned.
+// POST /recall?on=true|false starts or ends fire-service recall for the whole group.
+func statusThread(
+	ctx context.Context,
+	cfg common.Config,
+	statusSnapCh <-chan common.Snapshot,
+	maintenanceCh chan<- bool,
+	loadCh chan<- int,
+	destinationCh chan<- [2]int,
+	recallCh chan<- bool,
+) {
+	var mu sync.Mutex
+	report := statusReport{Self: cfg.SelfKey}
+	updated := make(chan struct{}) // closed and replaced on every new snapshot
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		body, err := json.Marshal(report)
+		mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+
+	mux.HandleFunc("POST /maintenance", func(w http.ResponseWriter, r *http.Request) {
+		on, err := strconv.ParseBool(r.URL.Query().Get("on"))
+		if err != nil {
+			http.Error(w, "on must be true or false", http.StatusBadRequest)
+			return
+		}
+		select {
+		case maintenanceCh <- on:
+			w.WriteHeader(http.StatusAccepted)
+		case <-r.Context().Done():
+		}
+	})
+
+	mux.HandleFunc("POST /load", func(w http.ResponseWriter, r *http.Request) {
+		if cfg.LoadSource != "api" {
+			http.Error(w, "load is "+cfg.LoadSource, http.StatusConflict)
+			return
+		}
+		percent, err := strconv.Atoi(r.URL.Query().Get("percent"))
+		if err != nil || percent < 0 || percent > 100 {
+			http.Error(w, "percent must be 0..100", http.StatusBadRequest)
+			return
+		}
+		select {
+		case loadCh <- percent:
+			w.WriteHeader(http.StatusAccepted)
+		case <-r.Context().Done():
+		}
+	})
+
+	mux.HandleFunc("POST /destination", func(w http.ResponseWriter, r *http.Request) {
+		if cfg.DispatchMode != "destination" {
+			http.Error(w, "dispatch mode is "+cfg.DispatchMode, http.StatusConflict)
+			return
+		}
+		from, err1 := strconv.Atoi(r.URL.Query().Get("from"))
+		to, err2 := strconv.Atoi(r.URL.Query().Get("to"))
+		if err1 != nil || err2 != nil || from == to || from < 0 || to < 0 || from >= common.N_FLOORS || to >= common.N_FLOORS {
+			http.Error(w, "from and to must be different floors", http.StatusBadRequest)
+			return
+		}
+		select {
+		case destinationCh <- [2]int{from, to}:
+		case <-r.Context().Done():
+			return
+		}
+
+		timeout := time.NewTimer(DESTINATION_ASSIGN_TIMEOUT)
+		defer timeout.Stop()
+		call := destinationCall{From: from, To: to}
+		status := http.StatusAccepted
+	wait:
+		for {
+			mu.Lock()
+			for _, c := range report.Destinations {
+				if c.From == from && c.To == to && c.Elevator != "" {
+					call, status = c, http.StatusOK
+				}
+			}
+			next := updated
+			mu.Unlock()
+			if status == http.StatusOK {
+				break
+			}
+			select {
+			case <-next:
+			case <-timeout.C:
+				break wait
+			case <-r.Context().Done():
+				return
+			}
+		}
+		body, err := json.Marshal(call)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	})
+
+	mux.HandleFunc("POST /recall", func(w http.ResponseWriter, r *http.Request) {
+		on, err := strconv.ParseBool(r.URL.Query().Get("on"))
+		if err != nil {
+			http.Error(w, "on must be true or false", http.StatusBadRequest)
+			return
+		}
+		select {
+		case recallCh <- on:
+			w.WriteHeader(http.StatusAccepted)
+		case <-r.Context().Done():
+		}
+	})
+
+	server := &http.Server{Addr: cfg.ListenAddrForPort(cfg.StatusPort), Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("statusThread: %v", err)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = server.Close()
+			return
+
+		case snap := <-statusSnapCh:
+			mu.Lock()
+			report.UpdatedAt = time.Now()
+			report.Snapshot = snap
+			prevAlarms := alarmSet(report.HallETAs)
+			report.HallETAs = hallETAsFromSnapshot(cfg, snap, report.UpdatedAt)
+			for key := range alarmSet(report.HallETAs) {
+				if !prevAlarms[key] {
+					report.HallAlarms++
+				}
+			}
+			report.Destinations = destinationsFromSnapshot(snap)
+			close(updated)
+			updated = make(chan struct{})
+			mu.Unlock()
+		}
+	}
+}
+
+// hallETAsFromSnapshot lists every active hall request with the ETA reported by the elevator
+// it is assigned to and how long it has been waiting.
+func hallETAsFromSnapshot(cfg common.Config, snap common.Snapshot, now time.Time) []hallETA {
+	etas := make([]hallETA, 0)
+	for f, hall := range snap.HallRequests {
+		for c, active := range hall {
+			if !active {
+				continue
+			}
+			entry := hallETA{Floor: f, Button: common.ElevioButtonToString(common.ButtonType(c))}
+			entry.Elevator, entry.ETA = assignedElevator(snap, f, c)
+			if f < len(snap.HallSince) && snap.HallSince[f][c] != 0 {
+				entry.Since = time.UnixMilli(snap.HallSince[f][c])
+				age := now.Sub(entry.Since)
+				entry.Overdue = f < len(snap.HallOverdue) && snap.HallOverdue[f][c]
+				entry.Alarm = cfg.HallAlarmLimit > 0 && age >= cfg.HallAlarmLimit
+			}
+			etas = append(etas, entry)
+		}
+	}
+	return etas
+}
+
+// destinationsFromSnapshot lists the waiting destination calls with the elevator that has
+// the hall request they raised.
+func destinationsFromSnapshot(snap common.Snapshot) []destinationCall {
+	calls := make([]destinationCall, 0)
+	for from, row := range snap.DestinationRequests {
+		for to, active := range row {
+			if !active {
+				continue
+			}
+			call := destinationCall{From: from, To: to}
+			call.Elevator, call.ETA = assignedElevator(snap, from, int(common.DestinationButton(from, to)))
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// assignedElevator finds the elevator that has a hall request and the ETA it reports (unix
+// ms on its own clock, a wall-clock estimate). With a leader's assignment that is the car the
+// leader chose. Otherwise it is the car reporting an ETA; if stale ETAs from two cars overlap,
+// the lowest id is taken so the answer does not change between requests.
+func assignedElevator(snap common.Snapshot, floor int, button int) (string, time.Time) {
+	eta := func(id string) time.Time {
+		st := snap.States[id]
+		if floor < len(st.HallETAs) && st.HallETAs[floor][button] != 0 {
+			return time.UnixMilli(st.HallETAs[floor][button])
+		}
+		return time.Time{}
+	}
+	if a := snap.Assignment; a != nil {
+		for id, hall := range a.HallTasks {
+			if floor < len(hall) && hall[floor][button] {
+				return id, eta(id)
+			}
+		}
+	}
+	ids := make([]string, 0, len(snap.States))
+	for id := range snap.States {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return common.KeyLess(ids[a], ids[b]) })
+	for _, id := range ids {
+		if t := eta(id); !t.IsZero() {
+			return id, t
+		}
+	}
+	return "", time.Time{}
+}
+
+// alarmSet is the set of hall requests in alarm, keyed by floor, button and raise time.
+func alarmSet(etas []hallETA) map[hallETA]bool {
+	set := make(map[hallETA]bool)
+	for _, e := range etas {
+		if e.Alarm {
+			set[hallETA{Floor: e.Floor, Button: e.Button, Since: e.Since}] = true
+		}
+	}
+	return set
+}